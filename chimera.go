@@ -70,6 +70,26 @@ type FluentMessage struct {
 	Path          string
 	HostFieldName string
 	Host          string
+	Fields        map[string]interface{}
+}
+
+// Record returns the record of the message sent to outputs.
+// Message, Path and Host are omitted when their field names are empty.
+func (m *FluentMessage) Record() map[string]interface{} {
+	v := make(map[string]interface{}, len(m.Fields)+3)
+	for key, value := range m.Fields {
+		v[key] = value
+	}
+	if m.FieldName != "" {
+		v[m.FieldName] = m.Message
+	}
+	if m.PathFieldName != "" {
+		v[m.PathFieldName] = m.Path
+	}
+	if m.HostFieldName != "" {
+		v[m.HostFieldName] = m.Host
+	}
+	return v
 }
 
 type Circumstances struct {
@@ -97,7 +117,16 @@ func (c *Circumstances) RunProcess(ctx context.Context, p Process, nowait bool)
 	go p.Run(ctx, c)
 }
 
+// Run starts all processes by config. The filters created by ReadConfig or BuildFilters are used.
+// When the filters cannot be created, no process is started and nil is returned.
 func Run(config *Config) *Circumstances {
+	if config.filterChain == nil {
+		if err := config.BuildFilters(); err != nil {
+			log.Println("[error] Couldn't create filters.", err)
+			return nil
+		}
+	}
+
 	c, ctx := NewCircumstances()
 
 	if config.ReadBufferSize > 0 {
@@ -113,12 +142,61 @@ func Run(config *Config) *Circumstances {
 		c.RunProcess(ctx, monitor, false)
 	}
 
-	// start out_forward
-	outForward, err := NewOutForward(config.Server, config.SubSecondTime)
-	if err != nil {
-		log.Println("[error]", err)
-	} else {
-		c.RunProcess(ctx, outForward, false)
+	// start pipeline
+	pipeline := NewPipeline(config.filterChain)
+
+	// start outputs
+	for _, cm := range config.MatchConfigs() {
+		output, err := NewOutput(cm, config)
+		if err != nil {
+			log.Println("[error]", err)
+			continue
+		}
+		pipeline.AddRoute(cm.Pattern, cm.Copy, output)
+		c.RunProcess(ctx, output, false)
+	}
+	c.RunProcess(ctx, pipeline, false)
+
+	// start inputs
+	for _, cf := range config.Forward {
+		forward, err := NewInForward(cf)
+		if err != nil {
+			log.Println("[error] Couldn't start forward input.", err)
+			continue
+		}
+		c.RunProcess(ctx, forward, false)
+	}
+	for _, cs := range config.Syslog {
+		syslog, err := NewInSyslog(cs)
+		if err != nil {
+			log.Println("[error] Couldn't start syslog input.", err)
+			continue
+		}
+		c.RunProcess(ctx, syslog, false)
+	}
+	if config.Stdin != nil {
+		stdin, err := NewInStdin(config.Stdin)
+		if err != nil {
+			log.Println("[error] Couldn't start stdin input.", err)
+		} else {
+			c.RunProcess(ctx, stdin, false)
+		}
+	}
+	for _, ce := range config.Exec {
+		exec, err := NewInExec(ce)
+		if err != nil {
+			log.Println("[error] Couldn't start exec input.", err)
+			continue
+		}
+		c.RunProcess(ctx, exec, false)
+	}
+	for _, ch := range config.HTTP {
+		in, err := NewInHTTP(ch)
+		if err != nil {
+			log.Println("[error] Couldn't start http input.", err)
+			continue
+		}
+		c.RunProcess(ctx, in, false)
 	}
 
 	// start watcher
@@ -45,11 +45,13 @@ var (
 
 func main() {
 	var (
-		configFile  string
-		help        bool
-		showVersion bool
+		configFile   string
+		stdoutFormat string
+		help         bool
+		showVersion  bool
 	)
 	flag.StringVar(&configFile, "c", "", "configuration file path")
+	flag.StringVar(&stdoutFormat, "stdout", "", "print messages to stdout instead of sending to outputs (json or msgpack)")
 	flag.BoolVar(&help, "h", false, "show help message")
 	flag.BoolVar(&help, "help", false, "show help message")
 	flag.BoolVar(&showVersion, "v", false, "show version")
@@ -87,10 +89,17 @@ func main() {
 		usage()
 	}
 
+	logWriter := os.Stdout
+	if stdoutFormat != "" {
+		// keep stdout for messages
+		config.SetStdoutOutput(stdoutFormat)
+		logWriter = os.Stderr
+	}
+
 	filter := &logutils.LevelFilter{
-		Levels: []logutils.LogLevel{"debug", "info", "warn", "error"},
+		Levels:   []logutils.LogLevel{"debug", "info", "warn", "error"},
 		MinLevel: logutils.LogLevel(config.LogLevel),
-		Writer: os.Stdout,
+		Writer:   logWriter,
 	}
 	log.SetOutput(filter)
 
@@ -21,9 +21,13 @@ limitations under the License.
 package chimera
 
 import (
+	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 	"regexp"
+	"strings"
+	"time"
 
 	"github.com/BurntSushi/toml"
 )
@@ -35,37 +39,288 @@ const (
 	DefaultPathFieldName = "path"
 	DefaultHostFieldName = "host"
 	DefaultLogLevel      = "info"
+	DefaultTagPattern    = "**"
+	DefaultOutputType    = "forward"
+	DefaultStdoutFormat  = "json"
+	DefaultMaxRetries    = 3
+
+	DefaultOutFileTimeFormat = "20060102"
+	DefaultOutFileFormat     = "json"
+	DefaultOutFileMaxFiles   = 5
+
+	DefaultHTTPTimeout   = 10 * time.Second
+	DefaultHTTPRetryWait = 1 * time.Second
+	DefaultHTTPFormat    = "json"
+	DefaultHTTPTimeKey   = "time"
+	DefaultBatchSize     = 100
+	DefaultFlushInterval = 1 * time.Second
+
+	DefaultElasticsearchIndex           = "chimera-{date}"
+	DefaultElasticsearchIndexTimeFormat = "2006.01.02"
+	DefaultElasticsearchTimestampKey    = "@timestamp"
+
+	DefaultLokiFormat        = "json"
+	DefaultLokiLineFormat    = "json"
+	DefaultLokiMaxBatchBytes = 1024 * 1024
+
+	DefaultWriteTimeout = 10 * time.Second
+	DefaultRetryWait    = 1 * time.Second
+
+	DefaultGELFNetwork     = "udp"
+	DefaultGELFAddress     = "127.0.0.1:12201"
+	DefaultGELFCompression = "gzip"
+	DefaultGELFChunkSize   = 1420
+
+	DefaultSyslogNetwork    = "udp"
+	DefaultSyslogAddress    = "127.0.0.1:514"
+	DefaultSyslogTLSAddress = "127.0.0.1:6514"
+	DefaultSyslogFormat     = "rfc5424"
+	DefaultSyslogFraming    = "octet-counting"
+	DefaultSyslogFacility   = "user"
+	DefaultSyslogSeverity   = "info"
+	DefaultSyslogAppName    = "${tag}"
+
+	DefaultInForwardAddress      = "127.0.0.1:24224"
+	DefaultInForwardMaxChunkSize = 16 * 1024 * 1024
+
+	DefaultInSyslogNetwork        = "udp"
+	DefaultInSyslogAddress        = "127.0.0.1:5140"
+	DefaultInSyslogTagPrefix      = "syslog"
+	DefaultInSyslogMaxMessageSize = 64 * 1024
+
+	DefaultParserFormat     = "raw"
+	DefaultParserTimeFormat = time.RFC3339
+	DefaultInStdinTag       = "stdin"
+
+	DefaultKubernetesTargetFileRegexp = `\.log$`
+	DefaultRotateWait                 = 5 * time.Second
+	DefaultFileTimeFormat             = "20060102"
+	DefaultReconcileInterval          = 1 * time.Minute
+
+	DefaultInExecTag      = "exec"
+	DefaultInExecInterval = 60 * time.Second
+
+	DefaultInHTTPAddress     = "127.0.0.1:9880"
+	DefaultInHTTPMaxBodySize = 1024 * 1024
 )
 
 type Config struct {
+	TagPrefix         string
+	FieldName         string
+	PathFieldName     string
+	HostFieldName     string
+	Host              string
+	ReadBufferSize    int
+	SubSecondTime     bool
+	PollInterval      Duration
+	ReconcileInterval Duration
+	Server            *ConfigServer
+	Logs              []*ConfigLogfile
+	Forward           []*ConfigInForward
+	Syslog            []*ConfigInSyslog
+	Stdin             *ConfigInStdin
+	Exec              []*ConfigInExec
+	HTTP              []*ConfigInHTTP
+	Filters           []*ConfigFilter
+	Match             []*ConfigMatch
+	Monitor           *ConfigMonitor
+	LogLevel          string
+
+	filterChain *FilterChain
+}
+
+type ConfigServer struct {
+	Network  string
+	Address  string
+	Fallback *ConfigOutFile
+	// MaxRetries is nil when not set, as 0 writes to Fallback without retries.
+	MaxRetries *int
+}
+
+type ConfigLogfile struct {
+	Tag               string
+	Basedir           string
+	Recursive         bool
+	Path              string
+	Exclude           []string
+	ExcludePath       []*PathPattern
+	MaxDepth          int
+	TargetFileRegexp  *Regexp
+	FileTimeFormat    string
+	FieldName         string
+	PathFieldName     string
+	HostFieldName     string
+	Host              string
+	DedupeWindow      Duration
+	Kubernetes        bool
+	KubernetesTag     bool
+	RotateWait        Duration
+	PollInterval      Duration
+	ReconcileInterval Duration
+	ConfigParser
+
+	excludeRegexps []*regexp.Regexp
+}
+
+type ConfigParser struct {
+	Format     string
+	TimeKey    string
+	TimeFormat string
+}
+
+type ConfigFilter struct {
+	Pattern *TagPattern
+	Type    string
+	Regexp  *Regexp
+	Exclude *Regexp
+	Window  Duration
+}
+
+type ConfigMatch struct {
+	Pattern       *TagPattern
+	Type          string
+	Copy          bool
+	Server        *ConfigServer
+	Stdout        *ConfigStdout
+	File          *ConfigOutFile
+	HTTP          *ConfigHTTP
+	Elasticsearch *ConfigElasticsearch
+	Loki          *ConfigLoki
+	OTLP          *ConfigOTLP
+	GELF          *ConfigGELF
+	Syslog        *ConfigSyslog
+}
+
+type ConfigStdout struct {
+	Format string
+}
+
+type ConfigOutFile struct {
+	Path           string
+	FileTimeFormat string
+	Format         string
+	MaxSize        int64
+	MaxFiles       int
+}
+
+// ConfigHTTPClient is common settings of outputs sending records over HTTP.
+type ConfigHTTPClient struct {
+	URL           string
+	Headers       map[string]string
+	Username      string
+	Password      string
+	BearerToken   string
+	Gzip          bool
+	Timeout       Duration
+	MaxRetries    int
+	RetryWait     Duration
+	BatchSize     int
+	FlushInterval Duration
+}
+
+type ConfigHTTP struct {
+	ConfigHTTPClient
+	Format  string
+	TimeKey string
+	TagKey  string
+}
+
+type ConfigElasticsearch struct {
+	ConfigHTTPClient
+	Index           string
+	IndexTimeFormat string
+	TypeName        string
+	TimestampKey    string
+}
+
+type ConfigLoki struct {
+	ConfigHTTPClient
+	Labels        map[string]string
+	Format        string
+	LineFormat    string
+	MaxBatchBytes int
+}
+
+type ConfigOTLP struct {
+	ConfigHTTPClient
+	ResourceAttributes map[string]string
+}
+
+type ConfigGELF struct {
+	Network     string
+	Address     string
+	Compression string
+	ChunkSize   int
+	Timeout     Duration
+	MaxRetries  int
+	RetryWait   Duration
+}
+
+type ConfigSyslog struct {
+	Network            string
+	Address            string
+	Format             string
+	Framing            string
+	Facility           string
+	Severity           string
+	FacilityKey        string
+	SeverityKey        string
+	TagMapping         bool
+	AppName            string
+	CAFile             string
+	CertFile           string
+	KeyFile            string
+	ServerName         string
+	InsecureSkipVerify bool
+	Timeout            Duration
+	MaxRetries         int
+	RetryWait          Duration
+}
+
+type ConfigInForward struct {
+	Address      string
+	Path         string
+	Heartbeat    bool
+	TagPrefix    string
+	FieldName    string
+	MaxChunkSize int
+}
+
+type ConfigInSyslog struct {
+	Network        string
+	Address        string
 	TagPrefix      string
 	FieldName      string
-	PathFieldName  string
 	HostFieldName  string
-	Host           string
-	ReadBufferSize int
-	SubSecondTime  bool
-	Server         *ConfigServer
-	Logs           []*ConfigLogfile
-	Monitor        *ConfigMonitor
-	LogLevel       string
+	MaxMessageSize int
 }
 
-type ConfigServer struct {
-	Network string
-	Address string
+type ConfigInStdin struct {
+	Tag           string
+	FieldName     string
+	HostFieldName string
+	Host          string
+	ConfigParser
 }
 
-type ConfigLogfile struct {
-	Tag              string
-	Basedir          string
-	Recursive        bool
-	TargetFileRegexp *Regexp
-	FileTimeFormat   string
-	FieldName        string
-	PathFieldName    string
-	HostFieldName    string
-	Host             string
+type ConfigInExec struct {
+	Tag           string
+	Command       string
+	Interval      Duration
+	Timeout       Duration
+	FieldName     string
+	HostFieldName string
+	Host          string
+	ConfigParser
+}
+
+type ConfigInHTTP struct {
+	Address       string
+	TagPrefix     string
+	FieldName     string
+	HostFieldName string
+	AuthToken     string
+	MaxBodySize   int64
 }
 
 type ConfigMonitor struct {
@@ -77,6 +332,17 @@ type Regexp struct {
 	*regexp.Regexp
 }
 
+// PathPattern is a regexp or a glob matched with paths. Patterns starting with "/" or "*" are globs,
+// and globs without "/" are matched with the base name of paths, as Exclude.
+type PathPattern struct {
+	*regexp.Regexp
+	baseName bool
+}
+
+type Duration struct {
+	time.Duration
+}
+
 func ReadConfig(filename string) (*Config, error) {
 	var config Config
 	log.Println("[info] Loading config file:", filename)
@@ -84,9 +350,47 @@ func ReadConfig(filename string) (*Config, error) {
 		return nil, err
 	}
 	config.Restrict()
+	for _, cp := range config.parserConfigs() {
+		if _, err := NewParser(cp); err != nil {
+			return nil, err
+		}
+	}
+	if err := config.BuildFilters(); err != nil {
+		return nil, err
+	}
 	return &config, nil
 }
 
+// BuildFilters creates the filters used by Run. ReadConfig calls it, so it is needed only
+// to check errors of Config built in code before Run.
+func (c *Config) BuildFilters() error {
+	configs, err := c.FilterConfigs()
+	if err != nil {
+		return err
+	}
+	filterChain, err := NewFilterChain(configs)
+	if err != nil {
+		return err
+	}
+	c.filterChain = filterChain
+	return nil
+}
+
+// parserConfigs returns ConfigParser of Logs, Stdin and Exec.
+func (c *Config) parserConfigs() []*ConfigParser {
+	configs := make([]*ConfigParser, 0, len(c.Logs)+len(c.Exec)+1)
+	for _, cl := range c.Logs {
+		configs = append(configs, &cl.ConfigParser)
+	}
+	if c.Stdin != nil {
+		configs = append(configs, &c.Stdin.ConfigParser)
+	}
+	for _, ce := range c.Exec {
+		configs = append(configs, &ce.ConfigParser)
+	}
+	return configs
+}
+
 func (cs *ConfigServer) Restrict(c *Config) {
 	if cs.Network == "" {
 		cs.Network = DefaultNetwork
@@ -94,6 +398,13 @@ func (cs *ConfigServer) Restrict(c *Config) {
 	if cs.Address == "" {
 		cs.Address = DefaultAddress
 	}
+	if cs.Fallback != nil {
+		cs.Fallback.Restrict(c)
+		if cs.MaxRetries == nil {
+			maxRetries := DefaultMaxRetries
+			cs.MaxRetries = &maxRetries
+		}
+	}
 }
 
 func (cl *ConfigLogfile) Restrict(c *Config) {
@@ -112,6 +423,424 @@ func (cl *ConfigLogfile) Restrict(c *Config) {
 	if c.TagPrefix != "" {
 		cl.Tag = c.TagPrefix + "." + cl.Tag
 	}
+	if cl.KubernetesTag {
+		cl.Kubernetes = true
+	}
+	if cl.RotateWait.Duration == 0 {
+		cl.RotateWait.Duration = DefaultRotateWait
+	}
+	if cl.PollInterval.Duration == 0 {
+		cl.PollInterval = c.PollInterval
+	}
+	if cl.ReconcileInterval.Duration == 0 {
+		cl.ReconcileInterval = c.ReconcileInterval
+	}
+	if cl.Path != "" && cl.TargetFileRegexp == nil {
+		if strings.Contains(cl.Path, "{date}") && cl.FileTimeFormat == "" {
+			cl.FileTimeFormat = DefaultFileTimeFormat
+		}
+		basedir, rest := globBasedir(cl.Path)
+		if cl.Basedir == "" {
+			cl.Basedir = basedir
+		}
+		if strings.Contains(rest, "/") {
+			cl.Recursive = true
+		}
+		cl.TargetFileRegexp = &Regexp{compileGlob(cl.Path, cl.FileTimeFormat)}
+	}
+	cl.excludeRegexps = nil
+	for _, exclude := range cl.Exclude {
+		cl.excludeRegexps = append(cl.excludeRegexps, compileGlob(exclude, cl.FileTimeFormat))
+	}
+	if cl.Kubernetes && cl.TargetFileRegexp == nil {
+		cl.TargetFileRegexp = &Regexp{regexp.MustCompile(DefaultKubernetesTargetFileRegexp)}
+	}
+	cl.ConfigParser.Restrict(c)
+}
+
+// excluded reports whether path is matched with Exclude globs or ExcludePath.
+// Globs without "/" are matched with the base name of path.
+func (cl *ConfigLogfile) excluded(path string) bool {
+	for i, re := range cl.excludeRegexps {
+		if !strings.Contains(cl.Exclude[i], "/") {
+			if re.MatchString(filepath.Base(path)) {
+				return true
+			}
+		} else if re.MatchString(path) {
+			return true
+		}
+	}
+	return cl.excludedPath(path)
+}
+
+// excludedPath reports whether path is matched with ExcludePath regexps or globs.
+func (cl *ConfigLogfile) excludedPath(path string) bool {
+	for _, p := range cl.ExcludePath {
+		if p.MatchPath(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// prunedDir reports whether the directory at path is not walked nor watched,
+// because it is matched with ExcludePath or deeper than MaxDepth under Basedir.
+func (cl *ConfigLogfile) prunedDir(path string) bool {
+	if cl.excludedPath(path) {
+		return true
+	}
+	if cl.MaxDepth > 0 {
+		rel, err := filepath.Rel(filepath.Clean(cl.Basedir), path)
+		if err == nil && rel != "." && len(strings.Split(rel, string(filepath.Separator))) > cl.MaxDepth {
+			return true
+		}
+	}
+	return false
+}
+
+func (cp *ConfigParser) Restrict(c *Config) {
+	if cp.Format == "" {
+		cp.Format = DefaultParserFormat
+	}
+	if cp.TimeFormat == "" {
+		cp.TimeFormat = DefaultParserTimeFormat
+	}
+}
+
+func (cs *ConfigInStdin) Restrict(c *Config) {
+	if cs.Tag == "" {
+		cs.Tag = DefaultInStdinTag
+	}
+	if cs.FieldName == "" {
+		cs.FieldName = c.FieldName
+	}
+	if cs.HostFieldName == "" {
+		cs.HostFieldName = c.HostFieldName
+	}
+	if cs.Host == "" {
+		cs.Host = c.Host
+	}
+	if c.TagPrefix != "" {
+		cs.Tag = c.TagPrefix + "." + cs.Tag
+	}
+	cs.ConfigParser.Restrict(c)
+}
+
+func (cf *ConfigFilter) Restrict(c *Config) {
+	if cf.Pattern == nil {
+		cf.Pattern = MustCompileTagPattern(DefaultTagPattern)
+	}
+}
+
+// FilterConfigs returns filters defined by [[Logs]] followed by [[Filters]].
+// DedupeWindow of [[Logs]] whose Tag starts with a placeholder is an error,
+// because the dedupe filter for the tag would apply to every tag.
+func (c *Config) FilterConfigs() ([]*ConfigFilter, error) {
+	configs := make([]*ConfigFilter, 0, len(c.Filters))
+	for _, cl := range c.Logs {
+		if cl.DedupeWindow.Duration > 0 {
+			pattern := QuoteTagPattern(cl.Tag)
+			if i := strings.Index(cl.Tag, "${"); i == 0 {
+				return nil, fmt.Errorf("DedupeWindow requires Tag %q to start with a literal prefix", cl.Tag)
+			} else if i > 0 {
+				// the tag is expanded by groups of TargetFileRegexp, so only the literal prefix is matched
+				pattern = QuoteTagPattern(cl.Tag[:i]) + "**"
+			} else if cl.KubernetesTag {
+				pattern += ".**"
+			}
+			configs = append(configs, &ConfigFilter{
+				Pattern: MustCompileTagPattern(pattern),
+				Type:    "dedupe",
+				Window:  cl.DedupeWindow,
+			})
+		}
+	}
+	return append(configs, c.Filters...), nil
+}
+
+func (cm *ConfigMatch) Restrict(c *Config) {
+	if cm.Pattern == nil {
+		cm.Pattern = MustCompileTagPattern(DefaultTagPattern)
+	}
+	if cm.Type == "" {
+		cm.Type = DefaultOutputType
+	}
+	if cm.Type == "forward" && cm.Server == nil {
+		cm.Server = &ConfigServer{}
+	}
+	if cm.Server != nil {
+		cm.Server.Restrict(c)
+	}
+	if cm.Type == "stdout" && cm.Stdout == nil {
+		cm.Stdout = &ConfigStdout{}
+	}
+	if cm.Stdout != nil {
+		cm.Stdout.Restrict(c)
+	}
+	if cm.File != nil {
+		cm.File.Restrict(c)
+	}
+	if cm.HTTP != nil {
+		cm.HTTP.Restrict(c)
+	}
+	if cm.Elasticsearch != nil {
+		cm.Elasticsearch.Restrict(c)
+	}
+	if cm.Loki != nil {
+		cm.Loki.Restrict(c)
+	}
+	if cm.OTLP != nil {
+		cm.OTLP.Restrict(c)
+	}
+	if cm.GELF != nil {
+		cm.GELF.Restrict(c)
+	}
+	if cm.Syslog != nil {
+		cm.Syslog.Restrict(c)
+	}
+}
+
+func (cf *ConfigOutFile) Restrict(c *Config) {
+	if cf.FileTimeFormat == "" {
+		cf.FileTimeFormat = DefaultOutFileTimeFormat
+	}
+	if cf.Format == "" {
+		cf.Format = DefaultOutFileFormat
+	}
+	if cf.MaxFiles == 0 {
+		cf.MaxFiles = DefaultOutFileMaxFiles
+	}
+}
+
+func (ch *ConfigHTTPClient) Restrict(c *Config) {
+	if ch.Timeout.Duration == 0 {
+		ch.Timeout.Duration = DefaultHTTPTimeout
+	}
+	if ch.MaxRetries == 0 {
+		ch.MaxRetries = DefaultMaxRetries
+	}
+	if ch.RetryWait.Duration == 0 {
+		ch.RetryWait.Duration = DefaultHTTPRetryWait
+	}
+	if ch.BatchSize == 0 {
+		ch.BatchSize = DefaultBatchSize
+	}
+	if ch.FlushInterval.Duration == 0 {
+		ch.FlushInterval.Duration = DefaultFlushInterval
+	}
+}
+
+func (ch *ConfigHTTP) Restrict(c *Config) {
+	ch.ConfigHTTPClient.Restrict(c)
+	if ch.Format == "" {
+		ch.Format = DefaultHTTPFormat
+	}
+	if ch.TimeKey == "" {
+		ch.TimeKey = DefaultHTTPTimeKey
+	}
+}
+
+func (ce *ConfigElasticsearch) Restrict(c *Config) {
+	ce.ConfigHTTPClient.Restrict(c)
+	if ce.Index == "" {
+		ce.Index = DefaultElasticsearchIndex
+	}
+	if ce.IndexTimeFormat == "" {
+		ce.IndexTimeFormat = DefaultElasticsearchIndexTimeFormat
+	}
+	if ce.TimestampKey == "" {
+		ce.TimestampKey = DefaultElasticsearchTimestampKey
+	}
+}
+
+func (cl *ConfigLoki) Restrict(c *Config) {
+	cl.ConfigHTTPClient.Restrict(c)
+	if len(cl.Labels) == 0 {
+		cl.Labels = map[string]string{"tag": "${tag}"}
+	}
+	if cl.Format == "" {
+		cl.Format = DefaultLokiFormat
+	}
+	if cl.LineFormat == "" {
+		cl.LineFormat = DefaultLokiLineFormat
+	}
+	if cl.MaxBatchBytes == 0 {
+		cl.MaxBatchBytes = DefaultLokiMaxBatchBytes
+	}
+}
+
+func (co *ConfigOTLP) Restrict(c *Config) {
+	co.ConfigHTTPClient.Restrict(c)
+}
+
+func (cg *ConfigGELF) Restrict(c *Config) {
+	if cg.Network == "" {
+		cg.Network = DefaultGELFNetwork
+	}
+	if cg.Address == "" {
+		cg.Address = DefaultGELFAddress
+	}
+	if cg.Compression == "" {
+		if cg.Network == "udp" {
+			cg.Compression = DefaultGELFCompression
+		} else {
+			cg.Compression = "none"
+		}
+	}
+	if cg.ChunkSize == 0 {
+		cg.ChunkSize = DefaultGELFChunkSize
+	}
+	if cg.Timeout.Duration == 0 {
+		cg.Timeout.Duration = DefaultWriteTimeout
+	}
+	if cg.MaxRetries == 0 {
+		cg.MaxRetries = DefaultMaxRetries
+	}
+	if cg.RetryWait.Duration == 0 {
+		cg.RetryWait.Duration = DefaultRetryWait
+	}
+}
+
+func (cs *ConfigSyslog) Restrict(c *Config) {
+	if cs.Network == "" {
+		cs.Network = DefaultSyslogNetwork
+	}
+	if cs.Address == "" {
+		if cs.Network == "tls" {
+			cs.Address = DefaultSyslogTLSAddress
+		} else {
+			cs.Address = DefaultSyslogAddress
+		}
+	}
+	if cs.Format == "" {
+		cs.Format = DefaultSyslogFormat
+	}
+	if cs.Framing == "" {
+		cs.Framing = DefaultSyslogFraming
+	}
+	if cs.Facility == "" {
+		cs.Facility = DefaultSyslogFacility
+	}
+	if cs.Severity == "" {
+		cs.Severity = DefaultSyslogSeverity
+	}
+	if cs.AppName == "" {
+		cs.AppName = DefaultSyslogAppName
+	}
+	if cs.Timeout.Duration == 0 {
+		cs.Timeout.Duration = DefaultWriteTimeout
+	}
+	if cs.MaxRetries == 0 {
+		cs.MaxRetries = DefaultMaxRetries
+	}
+	if cs.RetryWait.Duration == 0 {
+		cs.RetryWait.Duration = DefaultRetryWait
+	}
+}
+
+func (cf *ConfigInForward) Restrict(c *Config) {
+	if cf.Address == "" && cf.Path == "" {
+		cf.Address = DefaultInForwardAddress
+	}
+	if cf.FieldName == "" {
+		cf.FieldName = c.FieldName
+	}
+	if cf.MaxChunkSize == 0 {
+		cf.MaxChunkSize = DefaultInForwardMaxChunkSize
+	}
+}
+
+func (cs *ConfigInSyslog) Restrict(c *Config) {
+	if cs.Network == "" {
+		cs.Network = DefaultInSyslogNetwork
+	}
+	if cs.Address == "" {
+		cs.Address = DefaultInSyslogAddress
+	}
+	if cs.TagPrefix == "" {
+		cs.TagPrefix = DefaultInSyslogTagPrefix
+	}
+	if cs.FieldName == "" {
+		cs.FieldName = c.FieldName
+	}
+	if cs.HostFieldName == "" {
+		cs.HostFieldName = c.HostFieldName
+	}
+	if cs.MaxMessageSize == 0 {
+		cs.MaxMessageSize = DefaultInSyslogMaxMessageSize
+	}
+}
+
+func (ce *ConfigInExec) Restrict(c *Config) {
+	if ce.Tag == "" {
+		ce.Tag = DefaultInExecTag
+	}
+	if ce.Interval.Duration == 0 {
+		ce.Interval.Duration = DefaultInExecInterval
+	}
+	if ce.Timeout.Duration == 0 {
+		ce.Timeout.Duration = ce.Interval.Duration
+	}
+	if ce.FieldName == "" {
+		ce.FieldName = c.FieldName
+	}
+	if ce.HostFieldName == "" {
+		ce.HostFieldName = c.HostFieldName
+	}
+	if ce.Host == "" {
+		ce.Host = c.Host
+	}
+	if c.TagPrefix != "" {
+		ce.Tag = c.TagPrefix + "." + ce.Tag
+	}
+	ce.ConfigParser.Restrict(c)
+}
+
+func (ch *ConfigInHTTP) Restrict(c *Config) {
+	if ch.Address == "" {
+		ch.Address = DefaultInHTTPAddress
+	}
+	if ch.FieldName == "" {
+		ch.FieldName = c.FieldName
+	}
+	if ch.HostFieldName == "" {
+		ch.HostFieldName = c.HostFieldName
+	}
+	if ch.MaxBodySize == 0 {
+		ch.MaxBodySize = DefaultInHTTPMaxBodySize
+	}
+}
+
+func (cs *ConfigStdout) Restrict(c *Config) {
+	if cs.Format == "" {
+		cs.Format = DefaultStdoutFormat
+	}
+}
+
+// SetStdoutOutput replaces all outputs with a stdout output printing in format.
+func (c *Config) SetStdoutOutput(format string) {
+	c.Server = nil
+	c.Match = []*ConfigMatch{
+		&ConfigMatch{
+			Type:   "stdout",
+			Stdout: &ConfigStdout{Format: format},
+		},
+	}
+	c.Match[0].Restrict(c)
+}
+
+// MatchConfigs returns [[Match]] sections followed by [Server] which matches all tags.
+func (c *Config) MatchConfigs() []*ConfigMatch {
+	configs := make([]*ConfigMatch, 0, len(c.Match)+1)
+	configs = append(configs, c.Match...)
+	if c.Server != nil {
+		configs = append(configs, &ConfigMatch{
+			Pattern: MustCompileTagPattern(DefaultTagPattern),
+			Type:    "forward",
+			Server:  c.Server,
+		})
+	}
+	return configs
 }
 
 func (cr *ConfigMonitor) Restrict(c *Config) {
@@ -142,6 +871,27 @@ func (c *Config) Restrict() {
 	for _, subconf := range c.Logs {
 		subconf.Restrict(c)
 	}
+	for _, subconf := range c.Forward {
+		subconf.Restrict(c)
+	}
+	for _, subconf := range c.Syslog {
+		subconf.Restrict(c)
+	}
+	if c.Stdin != nil {
+		c.Stdin.Restrict(c)
+	}
+	for _, subconf := range c.Exec {
+		subconf.Restrict(c)
+	}
+	for _, subconf := range c.HTTP {
+		subconf.Restrict(c)
+	}
+	for _, subconf := range c.Filters {
+		subconf.Restrict(c)
+	}
+	for _, subconf := range c.Match {
+		subconf.Restrict(c)
+	}
 	if c.Monitor != nil {
 		c.Monitor.Restrict(c)
 	}
@@ -156,3 +906,29 @@ func (r *Regexp) UnmarshalText(text []byte) error {
 	r.Regexp, err = regexp.Compile(s)
 	return err
 }
+
+func (p *PathPattern) UnmarshalText(text []byte) error {
+	var err error
+	s := string(text)
+	if strings.HasPrefix(s, "/") || strings.HasPrefix(s, "*") {
+		p.Regexp, err = regexp.Compile(globRegexpString(s, DefaultFileTimeFormat))
+		p.baseName = !strings.Contains(s, "/")
+		return err
+	}
+	p.Regexp, err = regexp.Compile(s)
+	return err
+}
+
+// MatchPath reports whether path is matched with p.
+func (p *PathPattern) MatchPath(path string) bool {
+	if p.baseName {
+		return p.MatchString(filepath.Base(path))
+	}
+	return p.MatchString(path)
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	var err error
+	d.Duration, err = time.ParseDuration(strings.TrimSpace(string(text)))
+	return err
+}
@@ -1,8 +1,10 @@
 package chimera_test
 
 import (
+	"io/ioutil"
 	"os"
 	"testing"
+	"time"
 
 	chimera "github.com/kikumoto/fluent-agent-chimera"
 	pdebug "github.com/lestrrat/go-pdebug"
@@ -49,7 +51,12 @@ func TestReadConfig(t *testing.T) {
 	s := config.Server
 	if !assert.True(
 		t,
-		s.Network == "tcp" && s.Address == "127.0.0.1:24225",
+		s.Network == "tcp" && s.Address == "127.0.0.1:24225" &&
+			s.MaxRetries != nil && *s.MaxRetries == chimera.DefaultMaxRetries &&
+			s.Fallback.Path == "/var/spool/chimera/${tag}.{date}.log" &&
+			s.Fallback.FileTimeFormat == "20060102" &&
+			s.Fallback.Format == "json" &&
+			s.Fallback.MaxFiles == chimera.DefaultOutFileMaxFiles,
 		"invalid server got %v",
 		s,
 	) {
@@ -68,6 +75,7 @@ func TestReadConfig(t *testing.T) {
 			c.Basedir == "/var/log/app1/batch" &&
 			c.Recursive &&
 			c.FileTimeFormat == "20060102" &&
+			c.DedupeWindow.Duration == 5*time.Second &&
 			c.FieldName == "message" &&
 			c.PathFieldName == "path" &&
 			c.HostFieldName == "host" &&
@@ -95,6 +103,7 @@ func TestReadConfig(t *testing.T) {
 			c.Basedir == "/var/log/app2/weblog" &&
 			!c.Recursive &&
 			c.FileTimeFormat == "2006/01/02" &&
+			c.DedupeWindow.Duration == 0 &&
 			c.FieldName == "msg" &&
 			c.PathFieldName == "file" &&
 			c.HostFieldName == "server" &&
@@ -114,4 +123,294 @@ func TestReadConfig(t *testing.T) {
 	) {
 		return
 	}
+
+	if !assert.Equal(t, 2, len(config.Filters), "invalid filters %v", config.Filters) {
+		return
+	}
+	f := config.Filters[0]
+	if !assert.True(
+		t,
+		f.Type == "grep" &&
+			f.Pattern.Match("web.app1.batch") &&
+			!f.Pattern.Match("web.app2.weblog") &&
+			f.Regexp == nil &&
+			f.Exclude.MatchString("DEBUG foo"),
+		"invalid Filters[0] got %v",
+		f,
+	) {
+		return
+	}
+	f = config.Filters[1]
+	if !assert.True(
+		t,
+		f.Type == "grep" &&
+			f.Pattern.String() == chimera.DefaultTagPattern &&
+			f.Regexp.String() == ".",
+		"invalid Filters[1] got %v",
+		f,
+	) {
+		return
+	}
+
+	filters, err := config.FilterConfigs()
+	if !assert.NoError(t, err) {
+		return
+	}
+	if !assert.Equal(t, 3, len(filters), "invalid filter configs %v", filters) {
+		return
+	}
+	f = filters[0]
+	if !assert.True(
+		t,
+		f.Type == "dedupe" &&
+			f.Pattern.Match("web.app1.batch") &&
+			!f.Pattern.Match("web.app1.batch.foo") &&
+			f.Window.Duration == 5*time.Second,
+		"invalid FilterConfigs()[0] got %v",
+		f,
+	) {
+		return
+	}
+
+	matches := config.MatchConfigs()
+	if !assert.Equal(t, 2, len(matches), "invalid match configs %v", matches) {
+		return
+	}
+	m := matches[0]
+	if !assert.True(
+		t,
+		m.Type == "forward" &&
+			m.Copy &&
+			m.Pattern.Match("web.app2.weblog") &&
+			m.Pattern.Match("web.audit") &&
+			!m.Pattern.Match("web.app1.batch") &&
+			m.Server.Network == "unix" &&
+			m.Server.Address == "/var/run/fluentd.sock",
+		"invalid MatchConfigs()[0] got %v",
+		m,
+	) {
+		return
+	}
+	m = matches[1]
+	if !assert.True(
+		t,
+		m.Type == "forward" &&
+			!m.Copy &&
+			m.Pattern.Match("web.app1.batch") &&
+			m.Server == config.Server,
+		"invalid MatchConfigs()[1] got %v",
+		m,
+	) {
+		return
+	}
+}
+
+func TestReadConfigInvalidFilter(t *testing.T) {
+	if pdebug.Enabled {
+		g := pdebug.Marker("TestReadConfigInvalidFilter")
+		defer g.End()
+	}
+
+	f, err := ioutil.TempFile("", "chimera-config")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("[[Filters]]\nType = \"no_such_filter\"\n")
+	f.Close()
+
+	_, err = chimera.ReadConfig(f.Name())
+	if !assert.Error(t, err, "unknown filter type should fail to load config") {
+		return
+	}
+
+	config := &chimera.Config{
+		Filters: []*chimera.ConfigFilter{{Type: "no_such_filter"}},
+	}
+	config.Restrict()
+	if !assert.Error(t, config.BuildFilters(), "unknown filter type should fail to build") {
+		return
+	}
+	assert.Nil(t, chimera.Run(config), "no process should be started")
+}
+
+func TestReadConfigBuildsFiltersOnce(t *testing.T) {
+	if pdebug.Enabled {
+		g := pdebug.Marker("TestReadConfigBuildsFiltersOnce")
+		defer g.End()
+	}
+
+	built := 0
+	chimera.RegisterFilter("test_count", func(c *chimera.ConfigFilter) (chimera.Filter, error) {
+		built++
+		return &upperFilter{}, nil
+	})
+
+	f, err := ioutil.TempFile("", "chimera-config")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("[[Filters]]\nType = \"test_count\"\n")
+	f.Close()
+
+	config, err := chimera.ReadConfig(f.Name())
+	if !assert.NoError(t, err) {
+		return
+	}
+	c := chimera.Run(config)
+	if !assert.NotNil(t, c, "processes should be started") {
+		return
+	}
+	c.Shutdown()
+	assert.Equal(t, 1, built, "filters loaded by ReadConfig should be used by Run")
+}
+
+func TestReadConfigInvalidFormat(t *testing.T) {
+	if pdebug.Enabled {
+		g := pdebug.Marker("TestReadConfigInvalidFormat")
+		defer g.End()
+	}
+
+	for _, section := range []string{
+		"[[Logs]]\nTag = \"app\"\nBasedir = \"/var/log/app\"\nTargetFileRegexp = \"\\\\.log$\"\nFormat = \"no_such_format\"\n",
+		"[Stdin]\nTag = \"stdin\"\nFormat = \"no_such_format\"\n",
+		"[[Exec]]\nTag = \"exec\"\nCommand = \"date\"\nFormat = \"no_such_format\"\n",
+	} {
+		f, err := ioutil.TempFile("", "chimera-config")
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer os.Remove(f.Name())
+		f.WriteString(section)
+		f.Close()
+
+		_, err = chimera.ReadConfig(f.Name())
+		if !assert.Error(t, err, "unknown format should fail to load config: "+section) {
+			return
+		}
+	}
+}
+
+func TestReadConfigMaxRetries(t *testing.T) {
+	if pdebug.Enabled {
+		g := pdebug.Marker("TestReadConfigMaxRetries")
+		defer g.End()
+	}
+
+	for _, tc := range []struct {
+		setting  string
+		expected int
+	}{
+		{"", chimera.DefaultMaxRetries},
+		{"MaxRetries = 0\n", 0},
+		{"MaxRetries = 5\n", 5},
+	} {
+		f, err := ioutil.TempFile("", "chimera-config")
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer os.Remove(f.Name())
+		f.WriteString("[Server]\n" + tc.setting + "[Server.Fallback]\nPath = \"/var/spool/chimera/${tag}.log\"\n")
+		f.Close()
+
+		config, err := chimera.ReadConfig(f.Name())
+		if !assert.NoError(t, err) {
+			return
+		}
+		if !assert.NotNil(t, config.Server.MaxRetries) {
+			return
+		}
+		if !assert.Equal(t, tc.expected, *config.Server.MaxRetries, tc.setting) {
+			return
+		}
+	}
+}
+
+func TestFilterConfigsTagTemplate(t *testing.T) {
+	if pdebug.Enabled {
+		g := pdebug.Marker("TestFilterConfigsTagTemplate")
+		defer g.End()
+	}
+
+	for _, tc := range []struct {
+		tag       string
+		matched   []string
+		unmatched []string
+	}{
+		{"app.${app}", []string{"app.api", "app.api.v2"}, []string{"other.api", "application"}},
+		{"x${a}", []string{"xapi", "xapi.v2"}, []string{"api", "other.xapi"}},
+		{"app.${app}.${role}", []string{"app.api.web"}, []string{"other.api.web"}},
+	} {
+		config := &chimera.Config{
+			Logs: []*chimera.ConfigLogfile{
+				{Tag: tc.tag, DedupeWindow: chimera.Duration{Duration: time.Second}},
+			},
+		}
+		filters, err := config.FilterConfigs()
+		if !assert.NoError(t, err, tc.tag) {
+			return
+		}
+		if !assert.Len(t, filters, 1, tc.tag) {
+			return
+		}
+		for _, tag := range tc.matched {
+			if !assert.True(t, filters[0].Pattern.Match(tag), "%s should match %s", filters[0].Pattern, tag) {
+				return
+			}
+		}
+		for _, tag := range tc.unmatched {
+			if !assert.False(t, filters[0].Pattern.Match(tag), "%s should not match %s", filters[0].Pattern, tag) {
+				return
+			}
+		}
+	}
+
+	// placeholder-only tags would dedupe every tag
+	for _, tag := range []string{"${app}", "${app}.access"} {
+		config := &chimera.Config{
+			Logs: []*chimera.ConfigLogfile{
+				{Tag: tag, DedupeWindow: chimera.Duration{Duration: time.Second}},
+			},
+		}
+		_, err := config.FilterConfigs()
+		if !assert.Error(t, err, tag) {
+			return
+		}
+	}
+}
+
+func TestReadConfigInvalidExcludePath(t *testing.T) {
+	if pdebug.Enabled {
+		g := pdebug.Marker("TestReadConfigInvalidExcludePath")
+		defer g.End()
+	}
+
+	for _, tc := range []struct {
+		pattern string
+		valid   bool
+	}{
+		{`(archive`, false},
+		{`^.+/[cache$`, false},
+		{`^.+/cache$`, true},
+		{`/var/log/app/archive/**`, true}, // globs start with "/" or "*"
+		{`*.old`, true},
+	} {
+		f, err := ioutil.TempFile("", "chimera-config")
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer os.Remove(f.Name())
+		f.WriteString("[[Logs]]\nTag = \"app\"\nBasedir = \"/var/log/app\"\nTargetFileRegexp = \"\\\\.log$\"\nExcludePath = ['" + tc.pattern + "']\n")
+		f.Close()
+
+		_, err = chimera.ReadConfig(f.Name())
+		if tc.valid {
+			if !assert.NoError(t, err, tc.pattern) {
+				return
+			}
+		} else if !assert.Error(t, err, "invalid ExcludePath should fail to load config: "+tc.pattern) {
+			return
+		}
+	}
 }
@@ -51,6 +51,8 @@ type File struct {
 	PathFieldName string
 	HostFieldName string
 	Host          string
+	Parser        Parser
+	Fields        map[string]interface{}
 }
 
 func openFile(path string, startPos int64) (*File, error) {
@@ -76,6 +78,8 @@ func openFile(path string, startPos int64) (*File, error) {
 		"",
 		"",
 		"",
+		nil,
+		nil,
 	}
 
 	if startPos == SEEK_TAIL {
@@ -106,6 +110,15 @@ func (f *File) restrict() error {
 	return nil
 }
 
+// isRotated reports whether the file at Path is not the opened file any more.
+func (f *File) isRotated() bool {
+	stat, err := os.Stat(f.Path)
+	if err != nil {
+		return true
+	}
+	return !os.SameFile(stat, f.lastStat)
+}
+
 func (f *File) tailAndSend(messageCh chan *FluentMessage, monitorCh chan Stat) error {
 	for {
 		n, err := io.ReadAtLeast(f, f.readBuf, 1)
@@ -143,7 +156,7 @@ func (f *File) tailAndSend(messageCh chan *FluentMessage, monitorCh chan Stat) e
 		// send message
 		t := time.Now()
 		for _, msg := range bytes.Split(sendBuf, LineSeparator) {
-			messageCh <- &FluentMessage{
+			message := &FluentMessage{
 				Message:       msg,
 				Tag:           f.Tag,
 				Timestamp:     t,
@@ -153,6 +166,20 @@ func (f *File) tailAndSend(messageCh chan *FluentMessage, monitorCh chan Stat) e
 				HostFieldName: f.HostFieldName,
 				Host:          f.Host,
 			}
+			if len(f.Fields) > 0 {
+				message.Fields = make(map[string]interface{}, len(f.Fields))
+				for key, value := range f.Fields {
+					message.Fields[key] = value
+				}
+			}
+			if f.Parser != nil {
+				if err := f.Parser.Parse(message); err == errPartialLine {
+					continue
+				} else if err != nil {
+					log.Println("[debug]", f.Path, "failed to parse line. sent as is.", err)
+				}
+			}
+			messageCh <- message
 			monitorCh <- f.UpdateStat()
 		}
 	}
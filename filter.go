@@ -0,0 +1,120 @@
+package chimera
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Filter processes a FluentMessage passing through Pipeline.
+// It returns the messages to be passed to the next filter. Returning nil drops the message.
+type Filter interface {
+	Filter(*FluentMessage) []*FluentMessage
+}
+
+// FilterFlusher is implemented by filters which hold messages.
+// Pipeline calls Flush periodically, and with force at shutdown, to release the held messages.
+type FilterFlusher interface {
+	Flush(now time.Time, force bool) []*FluentMessage
+}
+
+// FilterFactory creates a Filter from [[Filters]] section.
+type FilterFactory func(*ConfigFilter) (Filter, error)
+
+var (
+	filterFactories = map[string]FilterFactory{
+		"grep":   NewFilterGrep,
+		"dedupe": NewFilterDedupe,
+	}
+	filterFactoriesMu sync.Mutex
+)
+
+// RegisterFilter makes a filter available by Type in [[Filters]] sections.
+// Applications embedding chimera can register their own filters before calling Run.
+func RegisterFilter(name string, factory FilterFactory) {
+	filterFactoriesMu.Lock()
+	defer filterFactoriesMu.Unlock()
+	filterFactories[name] = factory
+}
+
+func newFilter(config *ConfigFilter) (Filter, error) {
+	filterFactoriesMu.Lock()
+	factory, ok := filterFactories[config.Type]
+	filterFactoriesMu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown filter type: %q", config.Type)
+	}
+	return factory(config)
+}
+
+type filterEntry struct {
+	pattern *TagPattern
+	filter  Filter
+}
+
+// FilterChain applies filters in order of definition to messages whose tag matches their pattern.
+type FilterChain struct {
+	entries []*filterEntry
+}
+
+func NewFilterChain(configs []*ConfigFilter) (*FilterChain, error) {
+	fc := &FilterChain{}
+	for _, config := range configs {
+		filter, err := newFilter(config)
+		if err != nil {
+			return nil, err
+		}
+		fc.Add(config.Pattern, filter)
+		log.Printf("[info] Filter: type => %s, pattern => %s\n", config.Type, config.Pattern)
+	}
+	return fc, nil
+}
+
+// Add appends filter to the chain.
+func (fc *FilterChain) Add(pattern *TagPattern, filter Filter) {
+	fc.entries = append(fc.entries, &filterEntry{
+		pattern: pattern,
+		filter:  filter,
+	})
+}
+
+func (fc *FilterChain) Len() int {
+	return len(fc.entries)
+}
+
+// Apply passes message through the chain and returns the resulting messages.
+func (fc *FilterChain) Apply(message *FluentMessage) []*FluentMessage {
+	return fc.applyFrom(0, []*FluentMessage{message})
+}
+
+// Flush releases messages held by filters and passes them through the rest of the chain.
+func (fc *FilterChain) Flush(now time.Time, force bool) []*FluentMessage {
+	var result []*FluentMessage
+	for i, entry := range fc.entries {
+		if flusher, ok := entry.filter.(FilterFlusher); ok {
+			if messages := flusher.Flush(now, force); len(messages) > 0 {
+				result = append(result, fc.applyFrom(i+1, messages)...)
+			}
+		}
+	}
+	return result
+}
+
+func (fc *FilterChain) applyFrom(start int, messages []*FluentMessage) []*FluentMessage {
+	for _, entry := range fc.entries[start:] {
+		if len(messages) == 0 {
+			break
+		}
+		next := make([]*FluentMessage, 0, len(messages))
+		for _, m := range messages {
+			if entry.pattern.Match(m.Tag) {
+				next = append(next, entry.filter.Filter(m)...)
+			} else {
+				next = append(next, m)
+			}
+		}
+		messages = next
+	}
+	return messages
+}
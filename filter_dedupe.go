@@ -0,0 +1,107 @@
+package chimera
+
+import (
+	"bytes"
+	"reflect"
+	"sort"
+	"time"
+)
+
+const (
+	DefaultDedupeWindow = 10 * time.Second
+
+	RepeatCountFieldName    = "repeat_count"
+	FirstTimestampFieldName = "first_timestamp"
+	LastTimestampFieldName  = "last_timestamp"
+)
+
+// FilterDedupe collapses consecutive identical messages of the same tag and path within the window.
+// The first message of a run is passed as is, and the following repeats are held and released as one message
+// carrying repeat_count, first_timestamp and last_timestamp fields, when a different message arrives or the window has passed.
+// repeat_count is the number of the held repeats, which excludes the first message passed as is.
+// first_timestamp is the time of the first message, and last_timestamp is the time of the last repeat.
+// Messages are identical when both Message and Fields are equal. The window is measured by the wall clock.
+type FilterDedupe struct {
+	window  time.Duration
+	pending map[string]*dedupeEntry
+	now     func() time.Time
+}
+
+type dedupeEntry struct {
+	head      *FluentMessage
+	count     int64
+	last      time.Time
+	startedAt time.Time
+}
+
+func NewFilterDedupe(config *ConfigFilter) (Filter, error) {
+	window := config.Window.Duration
+	if window <= 0 {
+		window = DefaultDedupeWindow
+	}
+	return &FilterDedupe{
+		window:  window,
+		pending: make(map[string]*dedupeEntry),
+		now:     time.Now,
+	}, nil
+}
+
+func (f *FilterDedupe) Filter(message *FluentMessage) []*FluentMessage {
+	now := f.now()
+	key := message.Tag + "\x00" + message.Path
+	current, ok := f.pending[key]
+	if ok && now.Sub(current.startedAt) < f.window && sameMessage(current.head, message) {
+		current.count++
+		current.last = message.Timestamp
+		return nil
+	}
+	f.pending[key] = &dedupeEntry{
+		head:      message,
+		startedAt: now,
+	}
+	if ok && current.count > 0 {
+		return []*FluentMessage{current.collapse(), message}
+	}
+	return []*FluentMessage{message}
+}
+
+func (f *FilterDedupe) Flush(now time.Time, force bool) []*FluentMessage {
+	var expired []*dedupeEntry
+	for key, entry := range f.pending {
+		if force || now.Sub(entry.startedAt) >= f.window {
+			if entry.count > 0 {
+				expired = append(expired, entry)
+			}
+			delete(f.pending, key)
+		}
+	}
+	sort.Slice(expired, func(i, j int) bool {
+		return expired[i].startedAt.Before(expired[j].startedAt)
+	})
+	messages := make([]*FluentMessage, len(expired))
+	for i, entry := range expired {
+		messages[i] = entry.collapse()
+	}
+	return messages
+}
+
+func sameMessage(a, b *FluentMessage) bool {
+	if !bytes.Equal(a.Message, b.Message) || len(a.Fields) != len(b.Fields) {
+		return false
+	}
+	return len(a.Fields) == 0 || reflect.DeepEqual(a.Fields, b.Fields)
+}
+
+// collapse returns a message of the held repeats.
+func (e *dedupeEntry) collapse() *FluentMessage {
+	m := *e.head
+	m.Timestamp = e.last
+	m.Fields = make(map[string]interface{}, len(e.head.Fields)+3)
+	for key, value := range e.head.Fields {
+		m.Fields[key] = value
+	}
+	m.Fields[RepeatCountFieldName] = e.count
+	m.Fields[FirstTimestampFieldName] = e.head.Timestamp.Format(time.RFC3339Nano)
+	m.Fields[LastTimestampFieldName] = e.last.Format(time.RFC3339Nano)
+	return &m
+}
@@ -0,0 +1,168 @@
+package chimera
+
+import (
+	"testing"
+	"time"
+
+	pdebug "github.com/lestrrat/go-pdebug"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestFilterDedupe(clock *time.Time) *FilterDedupe {
+	f, _ := NewFilterDedupe(&ConfigFilter{Window: Duration{Duration: 10 * time.Second}})
+	dedupe := f.(*FilterDedupe)
+	dedupe.now = func() time.Time { return *clock }
+	return dedupe
+}
+
+func TestFilterDedupe(t *testing.T) {
+	if pdebug.Enabled {
+		g := pdebug.Marker("TestFilterDedupe")
+		defer g.End()
+	}
+
+	clock := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	f := newTestFilterDedupe(&clock)
+
+	base := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	message := func(sec int, msg string) *FluentMessage {
+		return &FluentMessage{
+			Tag:       "test",
+			Timestamp: base.Add(time.Duration(sec) * time.Second),
+			Path:      "/path/to/file",
+			Message:   []byte(msg),
+		}
+	}
+
+	// the first message of a run is passed at once
+	result := f.Filter(message(0, "same"))
+	if !assert.Len(t, result, 1, "the first message should be passed") {
+		return
+	}
+	for i := 1; i < 5; i++ {
+		result = append(result, f.Filter(message(i, "same"))...)
+	}
+	if !assert.Len(t, result, 1, "repeats should be held") {
+		return
+	}
+
+	// a different message releases the collapsed repeats
+	result = f.Filter(message(5, "other"))
+	if !assert.Len(t, result, 2, "collapsed repeats and the new message should be released") {
+		return
+	}
+	m := result[0]
+	if !assert.Equal(t, "same", string(m.Message)) {
+		return
+	}
+	if !assert.Equal(t, int64(4), m.Fields[RepeatCountFieldName]) {
+		return
+	}
+	if !assert.Equal(t, "2017-01-01T00:00:00Z", m.Fields[FirstTimestampFieldName], "first_timestamp should be of the message passed") {
+		return
+	}
+	if !assert.Equal(t, "2017-01-01T00:00:04Z", m.Fields[LastTimestampFieldName]) {
+		return
+	}
+	record := m.Record()
+	if !assert.Equal(t, int64(4), record[RepeatCountFieldName], "record should have fields") {
+		return
+	}
+	if !assert.Equal(t, "other", string(result[1].Message)) {
+		return
+	}
+
+	// the window is measured by the clock, not by the event time
+	clock = clock.Add(11 * time.Second)
+	if !assert.Len(t, f.Filter(message(6, "other")), 1, "the same message after the window starts a new run") {
+		return
+	}
+	if !assert.Len(t, f.Filter(message(7, "other")), 0, "repeat should be held") {
+		return
+	}
+	if !assert.Len(t, f.Flush(clock.Add(5*time.Second), false), 0, "repeats within the window should be held") {
+		return
+	}
+	result = f.Flush(clock.Add(10*time.Second), false)
+	if !assert.Len(t, result, 1, "repeats over the window should be released") {
+		return
+	}
+	if !assert.Equal(t, int64(1), result[0].Fields[RepeatCountFieldName]) {
+		return
+	}
+	if !assert.Equal(t, "2017-01-01T00:00:06Z", result[0].Fields[FirstTimestampFieldName]) {
+		return
+	}
+	if !assert.Equal(t, "2017-01-01T00:00:07Z", result[0].Fields[LastTimestampFieldName]) {
+		return
+	}
+	if !assert.Len(t, f.pending, 0, "expired entries should be removed") {
+		return
+	}
+
+	// forced flush releases everything
+	f.Filter(message(30, "last"))
+	f.Filter(message(31, "last"))
+	f.Filter(message(32, "last"))
+	result = f.Flush(clock, true)
+	if !assert.Len(t, result, 1, "held repeats should be released by force") {
+		return
+	}
+	if !assert.Equal(t, int64(2), result[0].Fields[RepeatCountFieldName]) {
+		return
+	}
+	if !assert.Equal(t, "2017-01-01T00:00:30Z", result[0].Fields[FirstTimestampFieldName]) {
+		return
+	}
+	assert.Equal(t, "2017-01-01T00:00:32Z", result[0].Fields[LastTimestampFieldName])
+}
+
+func TestFilterDedupeFields(t *testing.T) {
+	if pdebug.Enabled {
+		g := pdebug.Marker("TestFilterDedupeFields")
+		defer g.End()
+	}
+
+	clock := time.Now()
+	f := newTestFilterDedupe(&clock)
+
+	parser, err := NewParser(&ConfigParser{Format: "json"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	var result []*FluentMessage
+	for _, line := range []string{
+		`{"level":"info","msg":"a"}`,
+		`{"level":"error","msg":"a"}`,
+		`{"level":"warn","msg":"a"}`,
+		`{"level":"warn","msg":"a"}`,
+	} {
+		m := &FluentMessage{
+			Tag:       "test",
+			Timestamp: clock,
+			FieldName: "message",
+			Message:   []byte(line),
+		}
+		if !assert.NoError(t, parser.Parse(m)) {
+			return
+		}
+		if !assert.Nil(t, m.Message, "records should have no message") {
+			return
+		}
+		result = append(result, f.Filter(m)...)
+	}
+	result = append(result, f.Flush(clock, true)...)
+	if !assert.Len(t, result, 4) {
+		return
+	}
+	for i, level := range []string{"info", "error", "warn", "warn"} {
+		if !assert.Equal(t, level, result[i].Fields["level"]) {
+			return
+		}
+	}
+	_, ok := result[2].Fields[RepeatCountFieldName]
+	if !assert.False(t, ok, "different records should not be collapsed") {
+		return
+	}
+	assert.Equal(t, int64(1), result[3].Fields[RepeatCountFieldName])
+}
@@ -0,0 +1,31 @@
+package chimera
+
+import (
+	"errors"
+)
+
+// FilterGrep passes messages matched by Regexp and drops messages matched by Exclude.
+type FilterGrep struct {
+	regexp  *Regexp
+	exclude *Regexp
+}
+
+func NewFilterGrep(config *ConfigFilter) (Filter, error) {
+	if config.Regexp == nil && config.Exclude == nil {
+		return nil, errors.New("grep filter requires Regexp and/or Exclude")
+	}
+	return &FilterGrep{
+		regexp:  config.Regexp,
+		exclude: config.Exclude,
+	}, nil
+}
+
+func (f *FilterGrep) Filter(message *FluentMessage) []*FluentMessage {
+	if f.regexp != nil && !f.regexp.Match(message.Message) {
+		return nil
+	}
+	if f.exclude != nil && f.exclude.Match(message.Message) {
+		return nil
+	}
+	return []*FluentMessage{message}
+}
@@ -0,0 +1,132 @@
+package chimera_test
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	chimera "github.com/kikumoto/fluent-agent-chimera"
+	pdebug "github.com/lestrrat/go-pdebug"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTagPattern(t *testing.T) {
+	if pdebug.Enabled {
+		g := pdebug.Marker("TestTagPattern")
+		defer g.End()
+	}
+
+	tests := []struct {
+		pattern string
+		tag     string
+		match   bool
+	}{
+		{"a", "a", true},
+		{"a", "b", false},
+		{"a", "a.b", false},
+		{"a.*", "a.b", true},
+		{"a.*", "a", false},
+		{"a.*", "a.b.c", false},
+		{"a.**", "a", true},
+		{"a.**", "a.b", true},
+		{"a.**", "a.b.c", true},
+		{"a.**", "ab", false},
+		{"**.c", "c", true},
+		{"**.c", "a.b.c", true},
+		{"**.c", "a.bc", false},
+		{"a.**.c", "a.c", true},
+		{"a.**.c", "a.b.c", true},
+		{"a.**.c", "a.bc", false},
+		{"**", "anything.goes", true},
+		{"{a,b}.*", "a.x", true},
+		{"{a,b}.*", "b.x", true},
+		{"{a,b}.*", "c.x", false},
+		{"a.{b,c.**}", "a.c.d.e", true},
+		{"a.* b.*", "b.x", true},
+		{"a.* b.*", "c.x", false},
+		{"a\\*", "a*", true},
+		{"a\\*", "ab", false},
+	}
+	for _, test := range tests {
+		p, err := chimera.CompileTagPattern(test.pattern)
+		if !assert.NoError(t, err, "pattern %s should be compiled", test.pattern) {
+			return
+		}
+		if !assert.Equal(t, test.match, p.Match(test.tag), "pattern %s, tag %s", test.pattern, test.tag) {
+			return
+		}
+	}
+}
+
+type upperFilter struct{}
+
+func (f *upperFilter) Filter(m *chimera.FluentMessage) []*chimera.FluentMessage {
+	m.Message = []byte(strings.ToUpper(string(m.Message)))
+	return []*chimera.FluentMessage{m}
+}
+
+type splitFilter struct{}
+
+func (f *splitFilter) Filter(m *chimera.FluentMessage) []*chimera.FluentMessage {
+	result := []*chimera.FluentMessage{}
+	for _, s := range strings.Split(string(m.Message), ",") {
+		n := *m
+		n.Message = []byte(s)
+		result = append(result, &n)
+	}
+	return result
+}
+
+func TestFilterChain(t *testing.T) {
+	if pdebug.Enabled {
+		g := pdebug.Marker("TestFilterChain")
+		defer g.End()
+	}
+
+	chimera.RegisterFilter("test_upper", func(c *chimera.ConfigFilter) (chimera.Filter, error) {
+		return &upperFilter{}, nil
+	})
+	chimera.RegisterFilter("test_split", func(c *chimera.ConfigFilter) (chimera.Filter, error) {
+		return &splitFilter{}, nil
+	})
+
+	configs := []*chimera.ConfigFilter{
+		{Pattern: chimera.MustCompileTagPattern("app.**"), Type: "test_split"},
+		{Pattern: chimera.MustCompileTagPattern("app.web"), Type: "test_upper"},
+		{
+			Pattern: chimera.MustCompileTagPattern("**"),
+			Type:    "grep",
+			Exclude: &chimera.Regexp{Regexp: regexp.MustCompile(`(?i)^debug`)},
+		},
+	}
+	fc, err := chimera.NewFilterChain(configs)
+	if !assert.NoError(t, err, "NewFilterChain should succeed") {
+		return
+	}
+
+	tests := []struct {
+		tag      string
+		message  string
+		expected []string
+	}{
+		{"app.web", "foo,debug bar,baz", []string{"FOO", "BAZ"}},
+		{"app.batch", "foo,debug bar,baz", []string{"foo", "baz"}},
+		{"other", "foo,baz", []string{"foo,baz"}},
+		{"other", "debug foo,baz", []string{}},
+	}
+	for _, test := range tests {
+		result := fc.Apply(&chimera.FluentMessage{Tag: test.tag, Message: []byte(test.message)})
+		got := make([]string, len(result))
+		for i, m := range result {
+			got[i] = string(m.Message)
+		}
+		if !assert.Equal(t, test.expected, got, "tag %s, message %s", test.tag, test.message) {
+			return
+		}
+	}
+
+	_, err = chimera.NewFilterChain([]*chimera.ConfigFilter{
+		{Pattern: chimera.MustCompileTagPattern("**"), Type: "no_such_filter"},
+	})
+	assert.Error(t, err, "unknown filter type should be error")
+}
@@ -0,0 +1,102 @@
+package chimera
+
+import (
+	"bytes"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const globMetaChars = "*?{"
+
+var globPlaceholderRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// globBasedir splits pattern into the directory without glob meta characters and the rest.
+func globBasedir(pattern string) (string, string) {
+	segments := strings.Split(pattern, "/")
+	for i, segment := range segments {
+		if strings.ContainsAny(segment, globMetaChars) {
+			dir := strings.Join(segments[:i], "/")
+			if dir == "" && strings.HasPrefix(pattern, "/") {
+				dir = "/"
+			}
+			return dir, strings.Join(segments[i:], "/")
+		}
+	}
+	return filepath.Dir(pattern), filepath.Base(pattern)
+}
+
+// compileGlob compiles a glob pattern into a regexp matching whole paths.
+//   - "**/" matches zero or more directories, and "**" any characters including "/"
+//   - "*" matches any characters except "/", and "?" a character except "/"
+//   - "{a,b}" matches a or b
+//   - "{date}" matches a date formatted by timeFormat, as the group named "date"
+//   - "{name}" matches a part of the path segment, as the group named name
+func compileGlob(pattern string, timeFormat string) *regexp.Regexp {
+	return regexp.MustCompile(globRegexpString(pattern, timeFormat))
+}
+
+// globRegexpString converts a glob pattern into a regexp string, as compileGlob.
+func globRegexpString(pattern string, timeFormat string) string {
+	var buf bytes.Buffer
+	buf.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch c {
+		case '*':
+			if strings.HasPrefix(pattern[i:], "**/") {
+				buf.WriteString("(?:.*/)?")
+				i += 2
+			} else if strings.HasPrefix(pattern[i:], "**") {
+				buf.WriteString(".*")
+				i++
+			} else {
+				buf.WriteString("[^/]*")
+			}
+		case '?':
+			buf.WriteString("[^/]")
+		case '{':
+			end := strings.IndexByte(pattern[i:], '}')
+			if end < 0 {
+				buf.WriteString(regexp.QuoteMeta(pattern[i:]))
+				i = len(pattern)
+				break
+			}
+			inner := pattern[i+1 : i+end]
+			switch {
+			case inner == "date":
+				buf.WriteString("(?P<date>" + timeFormatRegexp(timeFormat) + ")")
+			case globPlaceholderRegexp.MatchString(inner):
+				buf.WriteString("(?P<" + inner + ">[^/]+?)")
+			default:
+				alternatives := strings.Split(inner, ",")
+				for j, alternative := range alternatives {
+					alternatives[j] = regexp.QuoteMeta(alternative)
+				}
+				buf.WriteString("(?:" + strings.Join(alternatives, "|") + ")")
+			}
+			i += end
+		default:
+			buf.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	buf.WriteString("$")
+	return buf.String()
+}
+
+// timeFormatRegexp returns a regexp matching dates formatted by layout of time.Format.
+// Digits in the layout match a digit, and letters match a letter.
+func timeFormatRegexp(layout string) string {
+	var buf bytes.Buffer
+	for _, c := range layout {
+		switch {
+		case c >= '0' && c <= '9':
+			buf.WriteString(`\d`)
+		case c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z':
+			buf.WriteString(`[A-Za-z]`)
+		default:
+			buf.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return buf.String()
+}
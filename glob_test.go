@@ -0,0 +1,115 @@
+package chimera
+
+import (
+	"testing"
+
+	pdebug "github.com/lestrrat/go-pdebug"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompileGlob(t *testing.T) {
+	if pdebug.Enabled {
+		g := pdebug.Marker("TestCompileGlob")
+		defer g.End()
+	}
+
+	tests := []struct {
+		pattern  string
+		path     string
+		expected bool
+	}{
+		{"/var/log/app/**/*.log", "/var/log/app/a.log", true},
+		{"/var/log/app/**/*.log", "/var/log/app/x/y/a.log", true},
+		{"/var/log/app/**/*.log", "/var/log/app/a.log.1", false},
+		{"/var/log/app/*.log", "/var/log/app/x/a.log", false},
+		{"/var/log/app/?.log", "/var/log/app/a.log", true},
+		{"/var/log/{nginx,httpd}/*.log", "/var/log/httpd/access.log", true},
+		{"/var/log/{nginx,httpd}/*.log", "/var/log/mysql/error.log", false},
+		{"/var/log/app/access_{date}.log", "/var/log/app/access_20180102.log", true},
+		{"/var/log/app/access_{date}.log", "/var/log/app/access_latest.log", false},
+		{"/var/log/app+1/*.log", "/var/log/app+1/a.log", true},
+	}
+	for _, test := range tests {
+		re := compileGlob(test.pattern, "20060102")
+		if !assert.Equal(t, test.expected, re.MatchString(test.path), test.pattern+" "+test.path) {
+			return
+		}
+	}
+
+	re := compileGlob("/var/log/{app}/{role}_{date}.log", "2006-01-02")
+	m := re.FindStringSubmatch("/var/log/api/web_2018-01-02.log")
+	if !assert.NotNil(t, m) {
+		return
+	}
+	for i, name := range re.SubexpNames() {
+		switch name {
+		case "app":
+			assert.Equal(t, "api", m[i])
+		case "role":
+			assert.Equal(t, "web", m[i])
+		case "date":
+			assert.Equal(t, "2018-01-02", m[i])
+		}
+	}
+}
+
+func TestGlobBasedir(t *testing.T) {
+	for _, test := range []struct {
+		pattern string
+		basedir string
+		rest    string
+	}{
+		{"/var/log/app/**/*.log", "/var/log/app", "**/*.log"},
+		{"/var/log/*.log", "/var/log", "*.log"},
+		{"/*/app.log", "/", "*/app.log"},
+		{"/var/log/app.log", "/var/log", "app.log"},
+	} {
+		basedir, rest := globBasedir(test.pattern)
+		if !assert.Equal(t, test.basedir, basedir, test.pattern) {
+			return
+		}
+		if !assert.Equal(t, test.rest, rest, test.pattern) {
+			return
+		}
+	}
+}
+
+func TestConfigLogfilePath(t *testing.T) {
+	config := &ConfigLogfile{
+		Tag:     "app",
+		Path:    "/var/log/app/**/access_{date}.log",
+		Exclude: []string{"*_20180103.log", "/var/log/app/old/**"},
+	}
+	config.Restrict(&Config{})
+	if !assert.Equal(t, "/var/log/app", config.Basedir) {
+		return
+	}
+	if !assert.True(t, config.Recursive) {
+		return
+	}
+	if !assert.Equal(t, DefaultFileTimeFormat, config.FileTimeFormat) {
+		return
+	}
+
+	foundFile := make(map[string]*TargetFile)
+	for _, path := range []string{
+		"/var/log/app/access_20180101.log",
+		"/var/log/app/access_20180102.log",
+		"/var/log/app/web/access_20180102.log",
+		"/var/log/app/web/access_20180103.log",
+		"/var/log/app/old/access_20180102.log",
+		"/var/log/app/web/error_20180102.log",
+	} {
+		if !assert.NoError(t, findFile(path, config, foundFile)) {
+			return
+		}
+	}
+	names := make(map[string]bool)
+	for _, target := range foundFile {
+		names[target.Name] = true
+	}
+	assert.Equal(t, map[string]bool{
+		"/var/log/app/access_20180102.log":     true,
+		"/var/log/app/web/access_20180102.log": true,
+	}, names)
+}
@@ -0,0 +1,210 @@
+package chimera
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	execMaxStderrSize = 1024
+)
+
+// InExec ... run the command periodically, and send each line of the output as FluentMessage.
+// The exit code and failures of the last run are reported to the monitor.
+type InExec struct {
+	command       string
+	interval      time.Duration
+	timeout       time.Duration
+	tag           string
+	fieldName     string
+	hostFieldName string
+	host          string
+	parser        Parser
+	runs          int64
+	failures      int64
+	messageCh     chan *FluentMessage
+	monitorCh     chan Stat
+}
+
+// limitedBuffer keeps the first max bytes written.
+type limitedBuffer struct {
+	bytes.Buffer
+	max int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if rest := b.max - b.Len(); rest > 0 {
+		if len(p) > rest {
+			b.Buffer.Write(p[:rest])
+		} else {
+			b.Buffer.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+func NewInExec(config *ConfigInExec) (*InExec, error) {
+	if config.Command == "" {
+		return nil, fmt.Errorf("exec input requires Command")
+	}
+	parser, err := NewParser(&config.ConfigParser)
+	if err != nil {
+		return nil, err
+	}
+	return &InExec{
+		command:       config.Command,
+		interval:      config.Interval.Duration,
+		timeout:       config.Timeout.Duration,
+		tag:           config.Tag,
+		fieldName:     config.FieldName,
+		hostFieldName: config.HostFieldName,
+		host:          config.Host,
+		parser:        parser,
+	}, nil
+}
+
+func (e *InExec) Run(ctx context.Context, c *Circumstances) {
+	c.InputProcess.Add(1)
+	defer c.InputProcess.Done()
+
+	e.messageCh = c.MessageCh
+	e.monitorCh = c.MonitorCh
+
+	log.Println("[info] in_exec: running", e.command, "every", e.interval)
+	c.StartProcess.Done()
+
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+	for {
+		e.execute(ctx)
+		select {
+		case <-ctx.Done():
+			log.Println("[info] in_exec: shutting down", e.command)
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (e *InExec) execute(ctx context.Context) {
+	runCtx, cancel := context.WithTimeout(ctx, e.timeout)
+	defer cancel()
+
+	stat := &ExecStat{
+		Tag:       e.tag,
+		Command:   e.command,
+		LastRunAt: time.Now(),
+	}
+	err := e.run(runCtx)
+	e.runs++
+	if err != nil {
+		if ctx.Err() != nil {
+			// interrupted by shutdown
+			return
+		}
+		if runCtx.Err() == context.DeadlineExceeded {
+			err = fmt.Errorf("timed out after %s", e.timeout)
+		}
+		e.failures++
+		stat.ExitCode = -1
+		cause := err
+		if ee, ok := err.(*execError); ok {
+			cause = ee.err
+		}
+		if exitErr, ok := cause.(*exec.ExitError); ok {
+			if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+				stat.ExitCode = status.ExitStatus()
+			}
+		}
+		stat.Error = err.Error()
+		log.Println("[warn] in_exec:", e.command, "failed.", err)
+	}
+	stat.Runs = e.runs
+	stat.Failures = e.failures
+	e.monitorCh <- stat
+}
+
+func (e *InExec) run(ctx context.Context) error {
+	cmd := exec.Command("sh", "-c", e.command)
+	// run in its own process group, so that children of the shell are killed together
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	stderr := &limitedBuffer{max: execMaxStderrSize}
+	cmd.Stderr = stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	exited := make(chan struct{})
+	defer close(exited)
+	go func() {
+		select {
+		case <-ctx.Done():
+			syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		case <-exited:
+		}
+	}()
+
+	r := bufio.NewReaderSize(stdout, ReadBufferSize)
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(line) > 0 {
+			e.send(ctx, bytes.TrimRight(line, "\r\n"))
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			cmd.Wait()
+			return err
+		}
+	}
+	if err := cmd.Wait(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return &execError{err: err, stderr: msg}
+		}
+		return err
+	}
+	return nil
+}
+
+func (e *InExec) send(ctx context.Context, line []byte) {
+	message := &FluentMessage{
+		Tag:           e.tag,
+		Timestamp:     time.Now(),
+		FieldName:     e.fieldName,
+		Message:       line,
+		HostFieldName: e.hostFieldName,
+		Host:          e.host,
+	}
+	if e.parser != nil {
+		if err := e.parser.Parse(message); err == errPartialLine {
+			return
+		} else if err != nil {
+			log.Println("[debug] in_exec: failed to parse line. sent as is.", err)
+		}
+	}
+	select {
+	case e.messageCh <- message:
+	case <-ctx.Done():
+	}
+}
+
+// execError is an error of the command with its stderr.
+type execError struct {
+	err    error
+	stderr string
+}
+
+func (e *execError) Error() string {
+	return e.err.Error() + ": " + e.stderr
+}
@@ -0,0 +1,136 @@
+package chimera_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/kikumoto/fluent-agent-chimera"
+	pdebug "github.com/lestrrat/go-pdebug"
+	"github.com/stretchr/testify/assert"
+)
+
+func runExecOnce(t *testing.T, config *ConfigInExec) ([]*FluentMessage, *ExecStat) {
+	config.Restrict(&Config{FieldName: "message", HostFieldName: "hostname", Host: "localhost"})
+	in, err := NewInExec(config)
+	if !assert.NoError(t, err, "NewInExec should succeed") {
+		return nil, nil
+	}
+
+	c, ctx := NewCircumstances()
+	c.RunProcess(ctx, in, false)
+	c.StartProcess.Wait()
+
+	var messages []*FluentMessage
+	var stat *ExecStat
+	done := make(chan struct{})
+	go func() {
+		for m := range c.MessageCh {
+			messages = append(messages, m)
+		}
+		close(done)
+	}()
+	timeout := time.After(5 * time.Second)
+	for stat == nil {
+		select {
+		case s := <-c.MonitorCh:
+			stat, _ = s.(*ExecStat)
+		case <-timeout:
+			t.Error("timed out waiting for the run")
+			c.Shutdown()
+			return nil, nil
+		}
+	}
+	go func() {
+		for range c.MonitorCh {
+		}
+	}()
+	c.Shutdown()
+	<-done
+	return messages, stat
+}
+
+func TestInExec(t *testing.T) {
+	if pdebug.Enabled {
+		g := pdebug.Marker("TestInExec")
+		defer g.End()
+	}
+
+	messages, stat := runExecOnce(t, &ConfigInExec{
+		Command:      `printf '{"message":"first","level":"info"}\nsecond\n'`,
+		Tag:          "cmd",
+		ConfigParser: ConfigParser{Format: "json"},
+	})
+	if stat == nil {
+		return
+	}
+	if !assert.Len(t, messages, 2) {
+		return
+	}
+	if !assert.Equal(t, "first", string(messages[0].Message)) {
+		return
+	}
+	if !assert.Equal(t, "info", messages[0].Fields["level"]) {
+		return
+	}
+	if !assert.Equal(t, "second", string(messages[1].Message)) {
+		return
+	}
+	for _, m := range messages {
+		if !assert.Equal(t, "cmd", m.Tag) {
+			return
+		}
+		if !assert.Equal(t, "localhost", m.Host) {
+			return
+		}
+	}
+	if !assert.Equal(t, "cmd", stat.Tag) {
+		return
+	}
+	if !assert.Equal(t, 0, stat.ExitCode) {
+		return
+	}
+	if !assert.Equal(t, int64(1), stat.Runs) {
+		return
+	}
+	assert.Equal(t, int64(0), stat.Failures)
+}
+
+func TestInExecFailure(t *testing.T) {
+	if pdebug.Enabled {
+		g := pdebug.Marker("TestInExecFailure")
+		defer g.End()
+	}
+
+	_, stat := runExecOnce(t, &ConfigInExec{
+		Command: "echo broken >&2; exit 3",
+	})
+	if stat == nil {
+		return
+	}
+	if !assert.Equal(t, 3, stat.ExitCode) {
+		return
+	}
+	if !assert.Contains(t, stat.Error, "broken") {
+		return
+	}
+	assert.Equal(t, int64(1), stat.Failures)
+
+	_, stat = runExecOnce(t, &ConfigInExec{
+		Command: "sleep 5",
+		Timeout: Duration{Duration: 100 * time.Millisecond},
+	})
+	if stat == nil {
+		return
+	}
+	if !assert.Equal(t, -1, stat.ExitCode) {
+		return
+	}
+	assert.Contains(t, stat.Error, "timed out")
+}
+
+func TestInExecRequiresCommand(t *testing.T) {
+	config := &ConfigInExec{}
+	config.Restrict(&Config{})
+	_, err := NewInExec(config)
+	assert.Error(t, err, "NewInExec should fail without Command")
+}
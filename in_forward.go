@@ -0,0 +1,347 @@
+package chimera
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// InForward ... listen on TCP and unix socket, and receive events by fluentd forward protocol.
+// Message, Forward, PackedForward and CompressedPackedForward modes are supported,
+// and ack is returned when the chunk option is sent.
+type InForward struct {
+	name         string
+	tagPrefix    string
+	fieldName    string
+	maxChunkSize int
+	listeners    []net.Listener
+	heartbeat    net.PacketConn
+	conns        map[net.Conn]struct{}
+	mu           sync.Mutex
+	wg           sync.WaitGroup
+	messageCh    chan *FluentMessage
+	monitorCh    chan Stat
+}
+
+func NewInForward(config *ConfigInForward) (*InForward, error) {
+	f := &InForward{
+		tagPrefix:    config.TagPrefix,
+		fieldName:    config.FieldName,
+		maxChunkSize: config.MaxChunkSize,
+		conns:        make(map[net.Conn]struct{}),
+	}
+	if config.Address != "" {
+		l, err := net.Listen("tcp", config.Address)
+		if err != nil {
+			return nil, err
+		}
+		f.listeners = append(f.listeners, l)
+		f.name = "forward:" + l.Addr().String()
+		if config.Heartbeat {
+			conn, err := net.ListenPacket("udp", l.Addr().String())
+			if err != nil {
+				f.Close()
+				return nil, err
+			}
+			f.heartbeat = conn
+		}
+	}
+	if config.Path != "" {
+		if _, err := os.Stat(config.Path); err == nil {
+			os.Remove(config.Path)
+		}
+		l, err := net.Listen("unix", config.Path)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		f.listeners = append(f.listeners, l)
+		if f.name == "" {
+			f.name = "forward:" + config.Path
+		}
+	}
+	if len(f.listeners) == 0 {
+		return nil, fmt.Errorf("forward input requires Address or Path")
+	}
+	return f, nil
+}
+
+// Addr returns the address of the first listener.
+func (f *InForward) Addr() net.Addr {
+	return f.listeners[0].Addr()
+}
+
+// Close closes listeners and connections.
+func (f *InForward) Close() {
+	for _, l := range f.listeners {
+		l.Close()
+	}
+	if f.heartbeat != nil {
+		f.heartbeat.Close()
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for conn := range f.conns {
+		conn.Close()
+	}
+}
+
+func (f *InForward) Run(ctx context.Context, c *Circumstances) {
+	c.InputProcess.Add(1)
+	defer c.InputProcess.Done()
+
+	f.messageCh = c.MessageCh
+	f.monitorCh = c.MonitorCh
+
+	log.Println("[info] in_forward: listening", f.name)
+	for _, l := range f.listeners {
+		f.wg.Add(1)
+		go f.accept(ctx, l)
+	}
+	if f.heartbeat != nil {
+		f.wg.Add(1)
+		go f.serveHeartbeat()
+	}
+	c.StartProcess.Done()
+
+	<-ctx.Done()
+	log.Println("[info] in_forward: shutting down", f.name)
+	f.Close()
+	f.wg.Wait()
+}
+
+func (f *InForward) accept(ctx context.Context, l net.Listener) {
+	defer f.wg.Done()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			select {
+			case <-ctx.Done():
+			default:
+				log.Println("[error] in_forward: failed to accept.", err)
+			}
+			return
+		}
+		f.mu.Lock()
+		f.conns[conn] = struct{}{}
+		f.mu.Unlock()
+		if ctx.Err() != nil {
+			// accepted while closing
+			conn.Close()
+		}
+		f.wg.Add(1)
+		go f.handleConn(ctx, conn)
+	}
+}
+
+// serveHeartbeat responds to UDP heartbeat packets.
+func (f *InForward) serveHeartbeat() {
+	defer f.wg.Done()
+	buf := make([]byte, 1024)
+	for {
+		_, addr, err := f.heartbeat.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		f.heartbeat.WriteTo([]byte{0}, addr)
+	}
+}
+
+func (f *InForward) handleConn(ctx context.Context, conn net.Conn) {
+	defer f.wg.Done()
+	defer func() {
+		conn.Close()
+		f.mu.Lock()
+		delete(f.conns, conn)
+		f.mu.Unlock()
+	}()
+
+	dec := newMsgpackDecoder(conn, f.maxChunkSize)
+	for {
+		v, err := dec.Decode()
+		if err != nil {
+			if err != io.EOF && ctx.Err() == nil {
+				log.Println("[warn] in_forward: failed to decode.", err)
+			}
+			return
+		}
+		messages, option, err := f.decodeEvents(v)
+		if err != nil {
+			log.Println("[warn] in_forward: invalid event.", err)
+			f.monitorCh <- &InputStat{
+				Input:  f.name,
+				Counts: map[string]int64{"errors": 1},
+			}
+			return
+		}
+		for _, m := range messages {
+			select {
+			case f.messageCh <- m:
+			case <-ctx.Done():
+				return
+			}
+		}
+		f.monitorCh <- &InputStat{
+			Input:  f.name,
+			Counts: map[string]int64{"received": int64(len(messages))},
+		}
+		if chunk, ok := option["chunk"]; ok {
+			ack, err := msgpackMarshal(map[string]interface{}{"ack": chunk})
+			if err != nil {
+				return
+			}
+			if _, err := conn.Write(ack); err != nil {
+				log.Println("[warn] in_forward: failed to write ack.", err)
+				return
+			}
+		}
+	}
+}
+
+// decodeEvents decodes an event of Message, Forward or (Compressed)PackedForward mode.
+func (f *InForward) decodeEvents(v interface{}) ([]*FluentMessage, map[string]interface{}, error) {
+	arr, ok := v.([]interface{})
+	if !ok || len(arr) < 2 {
+		return nil, nil, fmt.Errorf("event must be an array of at least 2 elements")
+	}
+	tag, ok := msgpackString(arr[0])
+	if !ok {
+		return nil, nil, fmt.Errorf("tag must be a string")
+	}
+	if f.tagPrefix != "" {
+		tag = f.tagPrefix + "." + tag
+	}
+
+	var messages []*FluentMessage
+	var option map[string]interface{}
+	switch entries := arr[1].(type) {
+	case []interface{}:
+		// Forward mode
+		for _, entry := range entries {
+			m, err := f.decodeEntry(tag, entry)
+			if err != nil {
+				return nil, nil, err
+			}
+			messages = append(messages, m)
+		}
+		option = msgpackOption(arr, 2)
+	case string, []byte:
+		// PackedForward mode
+		option = msgpackOption(arr, 2)
+		b, _ := msgpackBytes(entries)
+		var r io.Reader = bytes.NewReader(b)
+		if compressed, _ := msgpackString(option["compressed"]); compressed == "gzip" {
+			zr, err := gzip.NewReader(r)
+			if err != nil {
+				return nil, nil, err
+			}
+			r = zr
+		}
+		dec := newMsgpackDecoder(r, f.maxChunkSize)
+		for {
+			entry, err := dec.Decode()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, nil, err
+			}
+			if f.maxChunkSize > 0 && dec.BytesRead() > f.maxChunkSize {
+				return nil, nil, fmt.Errorf("entries exceed limit %d", f.maxChunkSize)
+			}
+			m, err := f.decodeEntry(tag, entry)
+			if err != nil {
+				return nil, nil, err
+			}
+			messages = append(messages, m)
+		}
+	default:
+		// Message mode
+		m, err := f.decodeEntry(tag, arr[1:])
+		if err != nil {
+			return nil, nil, err
+		}
+		messages = append(messages, m)
+		option = msgpackOption(arr, 3)
+	}
+	return messages, option, nil
+}
+
+// decodeEntry decodes [time, record] into FluentMessage.
+// The value of fieldName in the record is used as Message, and the others as Fields.
+func (f *InForward) decodeEntry(tag string, v interface{}) (*FluentMessage, error) {
+	entry, ok := v.([]interface{})
+	if !ok || len(entry) < 2 {
+		return nil, fmt.Errorf("entry must be an array of time and record")
+	}
+	t, ok := msgpackTime(entry[0])
+	if !ok {
+		return nil, fmt.Errorf("invalid event time: %v", entry[0])
+	}
+	record, ok := entry[1].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("record must be a map")
+	}
+	m := &FluentMessage{
+		Tag:       tag,
+		Timestamp: t,
+		Fields:    record,
+	}
+	if message, ok := msgpackBytes(record[f.fieldName]); ok {
+		m.FieldName = f.fieldName
+		m.Message = message
+		delete(record, f.fieldName)
+	}
+	return m, nil
+}
+
+func msgpackOption(arr []interface{}, i int) map[string]interface{} {
+	if len(arr) > i {
+		if option, ok := arr[i].(map[string]interface{}); ok {
+			return option
+		}
+	}
+	return map[string]interface{}{}
+}
+
+func msgpackString(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case []byte:
+		return string(v), true
+	}
+	return "", false
+}
+
+func msgpackBytes(v interface{}) ([]byte, bool) {
+	switch v := v.(type) {
+	case string:
+		return []byte(v), true
+	case []byte:
+		return v, true
+	}
+	return nil, false
+}
+
+func msgpackTime(v interface{}) (time.Time, bool) {
+	switch v := v.(type) {
+	case time.Time:
+		return v, true
+	case int64:
+		return time.Unix(v, 0), true
+	case uint64:
+		return time.Unix(int64(v), 0), true
+	case float64:
+		sec, frac := math.Modf(v)
+		return time.Unix(int64(sec), int64(frac*float64(time.Second))), true
+	}
+	return time.Time{}, false
+}
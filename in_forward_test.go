@@ -0,0 +1,275 @@
+package chimera
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	pdebug "github.com/lestrrat/go-pdebug"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMsgpackDecoder(t *testing.T) {
+	ts := time.Unix(1514764800, 123456789)
+	v := []interface{}{
+		nil, true, int64(-1), int64(-200), int64(70000), 1.5, "str", []byte{1, 2}, ts,
+		map[string]interface{}{"a": []interface{}{int64(1), "b"}},
+	}
+	b, err := msgpackMarshal(v)
+	if !assert.NoError(t, err) {
+		return
+	}
+	decoded, err := newMsgpackDecoder(bytes.NewReader(b), 0).Decode()
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, v, decoded)
+
+	_, err = newMsgpackDecoder(bytes.NewReader(b), 1).Decode()
+	assert.Error(t, err, "decoding string longer than maxSize should fail")
+}
+
+func TestMsgpackEncoderBoundaries(t *testing.T) {
+	var values []interface{}
+	for _, n := range []int{0, 15, 16, 31, 32, 255, 256, 65535, 65536} {
+		arr := make([]interface{}, n)
+		m := make(map[string]interface{}, n)
+		for i := range arr {
+			arr[i] = int64(i)
+			m[strconv.Itoa(i)] = int64(i)
+		}
+		values = append(values, strings.Repeat("x", n), bytes.Repeat([]byte{1}, n), arr, m)
+	}
+	for _, n := range []int64{127, 128, 255, 256, 65535, 65536, math.MaxUint32, math.MaxUint32 + 1, math.MaxInt64,
+		-32, -33, math.MinInt8, math.MinInt8 - 1, math.MinInt16, math.MinInt16 - 1, math.MinInt32, math.MinInt32 - 1, math.MinInt64} {
+		values = append(values, n)
+	}
+	for _, v := range values {
+		b, err := msgpackMarshal(v)
+		if !assert.NoError(t, err) {
+			return
+		}
+		decoded, err := newMsgpackDecoder(bytes.NewReader(b), 0).Decode()
+		if !assert.NoError(t, err) {
+			return
+		}
+		if !assert.Equal(t, v, decoded) {
+			return
+		}
+	}
+
+	_, err := msgpackMarshal(struct{}{})
+	assert.Error(t, err, "unsupported type should fail")
+}
+
+func TestMsgpackDecoderMalicious(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		data    []byte
+		maxSize int
+	}{
+		{"deeply nested arrays", bytes.Repeat([]byte{0x91}, 1000000), 0},
+		{"deeply nested maps", bytes.Repeat([]byte{0x81, 0xa1, 'k'}, 100000), 0},
+		{"huge array length", []byte{0xdd, 0xff, 0xff, 0xff, 0xff}, 1024},
+		{"huge map length", []byte{0xdf, 0xff, 0xff, 0xff, 0xff}, 1024},
+		{"huge string length", []byte{0xdb, 0xff, 0xff, 0xff, 0xff}, 1024},
+		{"huge ext length", []byte{0xc9, 0xff, 0xff, 0xff, 0xff, 0x01}, 1024},
+		// each string fits in maxSize, but the array does not
+		{"many small strings", append([]byte{0x94}, bytes.Repeat([]byte{0xa4, 'a', 'b', 'c', 'd'}, 4)...), 16},
+	} {
+		_, err := newMsgpackDecoder(bytes.NewReader(tc.data), tc.maxSize).Decode()
+		if !assert.Error(t, err, tc.name) {
+			return
+		}
+	}
+
+	// the limit is applied to each value
+	b, _ := msgpackMarshal("abcd")
+	dec := newMsgpackDecoder(bytes.NewReader(bytes.Repeat(b, 3)), len(b))
+	for i := 0; i < 3; i++ {
+		v, err := dec.Decode()
+		if !assert.NoError(t, err) {
+			return
+		}
+		if !assert.Equal(t, "abcd", v) {
+			return
+		}
+	}
+	assert.Equal(t, 3*len(b), dec.BytesRead())
+}
+
+func TestInForwardPackedLimit(t *testing.T) {
+	config := &ConfigInForward{
+		Address:      "127.0.0.1:0",
+		MaxChunkSize: 64,
+	}
+	config.Restrict(&Config{FieldName: "message"})
+	in, err := NewInForward(config)
+	if !assert.NoError(t, err, "NewInForward should succeed") {
+		return
+	}
+	defer in.Close()
+
+	// compressed entries expanding over MaxChunkSize
+	var entries bytes.Buffer
+	for i := 0; i < 10; i++ {
+		b, _ := msgpackMarshal([]interface{}{int64(1514764800), map[string]interface{}{"message": "0123456789"}})
+		entries.Write(b)
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(entries.Bytes())
+	zw.Close()
+	_, _, err = in.decodeEvents([]interface{}{"test", buf.Bytes(), map[string]interface{}{"compressed": "gzip"}})
+	assert.Error(t, err, "entries over MaxChunkSize should be rejected")
+}
+
+func TestInForward(t *testing.T) {
+	if pdebug.Enabled {
+		g := pdebug.Marker("TestInForward")
+		defer g.End()
+	}
+
+	tmpdir, _ := ioutil.TempDir("", "chimera-in_forward")
+	defer os.RemoveAll(tmpdir)
+
+	config := &ConfigInForward{
+		Address:   "127.0.0.1:0",
+		Path:      filepath.Join(tmpdir, "forward.sock"),
+		Heartbeat: true,
+		TagPrefix: "fwd",
+	}
+	config.Restrict(&Config{FieldName: "message"})
+	in, err := NewInForward(config)
+	if !assert.NoError(t, err, "NewInForward should succeed") {
+		return
+	}
+	c, ctx := NewCircumstances()
+	c.RunProcess(ctx, in, false)
+	c.StartProcess.Wait()
+	go func() {
+		for range c.MonitorCh {
+		}
+	}()
+
+	ts := time.Unix(1514764800, 500)
+	var packed bytes.Buffer
+	for _, m := range []string{"packed1", "packed2"} {
+		b, _ := msgpackMarshal([]interface{}{ts, map[string]interface{}{"message": m}})
+		packed.Write(b)
+	}
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	zw.Write(packed.Bytes())
+	zw.Close()
+
+	events := []interface{}{
+		// Message mode with ack
+		[]interface{}{"message", int64(1514764800), map[string]interface{}{"message": "hello", "level": "info"}, map[string]interface{}{"chunk": "abc"}},
+		// Forward mode
+		[]interface{}{"forward", []interface{}{
+			[]interface{}{ts, map[string]interface{}{"message": "forward1"}},
+			[]interface{}{ts, map[string]interface{}{"other": int64(1)}},
+		}},
+		// PackedForward mode
+		[]interface{}{"packed", packed.Bytes()},
+		// CompressedPackedForward mode
+		[]interface{}{"compressed", compressed.Bytes(), map[string]interface{}{"compressed": "gzip"}},
+	}
+
+	conn, err := net.Dial("tcp", in.Addr().String())
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+	for _, event := range events {
+		b, _ := msgpackMarshal(event)
+		conn.Write(b)
+	}
+
+	expected := []struct {
+		tag     string
+		message string
+		fields  map[string]interface{}
+	}{
+		{"fwd.message", "hello", map[string]interface{}{"level": "info"}},
+		{"fwd.forward", "forward1", map[string]interface{}{}},
+		{"fwd.forward", "", map[string]interface{}{"other": int64(1)}},
+		{"fwd.packed", "packed1", map[string]interface{}{}},
+		{"fwd.packed", "packed2", map[string]interface{}{}},
+		{"fwd.compressed", "packed1", map[string]interface{}{}},
+		{"fwd.compressed", "packed2", map[string]interface{}{}},
+	}
+	for _, e := range expected {
+		select {
+		case m := <-c.MessageCh:
+			if !assert.Equal(t, e.tag, m.Tag) {
+				return
+			}
+			if !assert.Equal(t, e.message, string(m.Message)) {
+				return
+			}
+			if !assert.Equal(t, e.fields, m.Fields) {
+				return
+			}
+		case <-time.After(3 * time.Second):
+			t.Error("message should be received")
+			return
+		}
+	}
+
+	conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	ack, err := newMsgpackDecoder(conn, 0).Decode()
+	if !assert.NoError(t, err, "ack should be returned") {
+		return
+	}
+	if !assert.Equal(t, map[string]interface{}{"ack": "abc"}, ack) {
+		return
+	}
+
+	// unix socket
+	uconn, err := net.Dial("unix", config.Path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer uconn.Close()
+	b, _ := msgpackMarshal([]interface{}{"unix", ts, map[string]interface{}{"message": "via unix"}})
+	uconn.Write(b)
+	select {
+	case m := <-c.MessageCh:
+		if !assert.Equal(t, "fwd.unix", m.Tag) {
+			return
+		}
+		if !assert.Equal(t, ts, m.Timestamp) {
+			return
+		}
+	case <-time.After(3 * time.Second):
+		t.Error("message should be received via unix socket")
+		return
+	}
+
+	// heartbeat
+	hconn, err := net.Dial("udp", in.Addr().String())
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer hconn.Close()
+	hconn.Write([]byte{0})
+	hconn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	buf := make([]byte, 8)
+	n, err := hconn.Read(buf)
+	if !assert.NoError(t, err, "heartbeat should be responded") {
+		return
+	}
+	assert.Equal(t, []byte{0}, buf[:n])
+
+	c.Shutdown()
+}
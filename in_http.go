@@ -0,0 +1,265 @@
+package chimera
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// httpShutdownTimeout is how long shutdown waits for requests in flight.
+const httpShutdownTimeout = 10 * time.Second
+
+// InHTTP ... listen on HTTP, and receive events by "POST /<tag>".
+// The body is a JSON, msgpack or form payload of a record or an array of records.
+// Form payload can have the record in "json" or "msgpack" parameter, otherwise parameters are used as the record.
+type InHTTP struct {
+	name          string
+	tagPrefix     string
+	fieldName     string
+	hostFieldName string
+	authToken     string
+	maxBodySize   int64
+	listener      net.Listener
+	server        *http.Server
+	wg            sync.WaitGroup
+	messageCh     chan *FluentMessage
+	monitorCh     chan Stat
+}
+
+// httpInputError is an error responded to the client with the status code.
+type httpInputError struct {
+	status int
+	err    error
+}
+
+func (e *httpInputError) Error() string {
+	return e.err.Error()
+}
+
+func NewInHTTP(config *ConfigInHTTP) (*InHTTP, error) {
+	l, err := net.Listen("tcp", config.Address)
+	if err != nil {
+		return nil, err
+	}
+	return &InHTTP{
+		name:          "http:" + l.Addr().String(),
+		tagPrefix:     config.TagPrefix,
+		fieldName:     config.FieldName,
+		hostFieldName: config.HostFieldName,
+		authToken:     config.AuthToken,
+		maxBodySize:   config.MaxBodySize,
+		listener:      l,
+	}, nil
+}
+
+// Addr returns the listening address.
+func (h *InHTTP) Addr() net.Addr {
+	return h.listener.Addr()
+}
+
+// Close closes the listener and connections.
+func (h *InHTTP) Close() {
+	if h.server != nil {
+		h.server.Close()
+	} else {
+		h.listener.Close()
+	}
+}
+
+func (h *InHTTP) Run(ctx context.Context, c *Circumstances) {
+	c.InputProcess.Add(1)
+	defer c.InputProcess.Done()
+
+	h.messageCh = c.MessageCh
+	h.monitorCh = c.MonitorCh
+
+	h.server = &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h.handle(ctx, w, r)
+		}),
+	}
+	log.Println("[info] in_http: listening", h.name)
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+		if err := h.server.Serve(h.listener); err != nil && ctx.Err() == nil {
+			log.Println("[error] in_http: failed to serve.", err)
+		}
+	}()
+	c.StartProcess.Done()
+
+	<-ctx.Done()
+	log.Println("[info] in_http: shutting down", h.name)
+	// wait for requests in flight, which return soon as ctx is done
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), httpShutdownTimeout)
+	defer cancel()
+	if err := h.server.Shutdown(shutdownCtx); err != nil {
+		log.Println("[warn] in_http: failed to shut down gracefully.", err)
+		h.Close()
+	}
+	h.wg.Wait()
+}
+
+func (h *InHTTP) handle(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.authToken != "" {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(h.authToken)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+	messages, err := h.decodeRequest(r)
+	if err != nil {
+		status := http.StatusBadRequest
+		if e, ok := err.(*httpInputError); ok {
+			status = e.status
+		}
+		log.Println("[warn] in_http: invalid request.", err)
+		h.monitorCh <- &InputStat{
+			Input:  h.name,
+			Counts: map[string]int64{"errors": 1},
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	for _, m := range messages {
+		if ctx.Err() != nil {
+			http.Error(w, "shutting down", http.StatusServiceUnavailable)
+			return
+		}
+		select {
+		case h.messageCh <- m:
+		case <-ctx.Done():
+			http.Error(w, "shutting down", http.StatusServiceUnavailable)
+			return
+		}
+	}
+	h.monitorCh <- &InputStat{
+		Input:  h.name,
+		Counts: map[string]int64{"received": int64(len(messages))},
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// decodeRequest decodes the request into FluentMessages.
+// The tag is the path, in which "/" is replaced with ".", and the time is "time" parameter in unix time or now.
+func (h *InHTTP) decodeRequest(r *http.Request) ([]*FluentMessage, error) {
+	tag := strings.Replace(strings.Trim(r.URL.Path, "/"), "/", ".", -1)
+	if tag == "" {
+		return nil, fmt.Errorf("tag is required as the path")
+	}
+	if h.tagPrefix != "" {
+		tag = h.tagPrefix + "." + tag
+	}
+	t := time.Now()
+	if v := r.URL.Query().Get("time"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time: %q", v)
+		}
+		t, _ = parseTimeValue(f, "unix")
+	}
+
+	if r.ContentLength > h.maxBodySize {
+		return nil, &httpInputError{
+			status: http.StatusRequestEntityTooLarge,
+			err:    fmt.Errorf("body size %d exceeds limit %d", r.ContentLength, h.maxBodySize),
+		}
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, h.maxBodySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > h.maxBodySize {
+		return nil, &httpInputError{
+			status: http.StatusRequestEntityTooLarge,
+			err:    fmt.Errorf("body exceeds limit %d", h.maxBodySize),
+		}
+	}
+
+	v, err := h.decodeBody(r.Header.Get("Content-Type"), body)
+	if err != nil {
+		return nil, err
+	}
+	var records []interface{}
+	if arr, ok := v.([]interface{}); ok {
+		records = arr
+	} else {
+		records = []interface{}{v}
+	}
+
+	host, _, _ := net.SplitHostPort(r.RemoteAddr)
+	messages := make([]*FluentMessage, 0, len(records))
+	for _, v := range records {
+		record, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("record must be a map")
+		}
+		m := &FluentMessage{
+			Tag:           tag,
+			Timestamp:     t,
+			HostFieldName: h.hostFieldName,
+			Host:          host,
+			Fields:        record,
+		}
+		if message, ok := msgpackBytes(record[h.fieldName]); ok {
+			m.FieldName = h.fieldName
+			m.Message = message
+			delete(record, h.fieldName)
+		}
+		messages = append(messages, m)
+	}
+	return messages, nil
+}
+
+func (h *InHTTP) decodeBody(contentType string, body []byte) (interface{}, error) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "application/msgpack", "application/x-msgpack":
+		return newMsgpackDecoder(bytes.NewReader(body), int(h.maxBodySize)).Decode()
+	case "application/x-www-form-urlencoded":
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			return nil, err
+		}
+		if v := form.Get("json"); v != "" {
+			return h.decodeBody("application/json", []byte(v))
+		}
+		if v := form.Get("msgpack"); v != "" {
+			return h.decodeBody("application/msgpack", []byte(v))
+		}
+		record := make(map[string]interface{}, len(form))
+		for key := range form {
+			record[key] = form.Get(key)
+		}
+		return record, nil
+	case "", "application/json", "text/plain":
+		var v interface{}
+		if err := json.Unmarshal(body, &v); err != nil {
+			return nil, err
+		}
+		return v, nil
+	}
+	return nil, &httpInputError{
+		status: http.StatusUnsupportedMediaType,
+		err:    fmt.Errorf("unsupported content type: %q", contentType),
+	}
+}
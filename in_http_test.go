@@ -0,0 +1,182 @@
+package chimera
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	pdebug "github.com/lestrrat/go-pdebug"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInHTTP(t *testing.T) {
+	if pdebug.Enabled {
+		g := pdebug.Marker("TestInHTTP")
+		defer g.End()
+	}
+
+	config := &ConfigInHTTP{
+		Address:     "127.0.0.1:0",
+		TagPrefix:   "http",
+		AuthToken:   "secret",
+		MaxBodySize: 100,
+	}
+	config.Restrict(&Config{FieldName: "message", HostFieldName: "hostname"})
+	in, err := NewInHTTP(config)
+	if !assert.NoError(t, err, "NewInHTTP should succeed") {
+		return
+	}
+	c, ctx := NewCircumstances()
+	c.RunProcess(ctx, in, false)
+	c.StartProcess.Wait()
+	go func() {
+		for range c.MonitorCh {
+		}
+	}()
+	var messages []*FluentMessage
+	done := make(chan struct{})
+	go func() {
+		for m := range c.MessageCh {
+			messages = append(messages, m)
+		}
+		close(done)
+	}()
+
+	base := "http://" + in.Addr().String()
+	post := func(path, contentType string, body []byte, token string) int {
+		req, err := http.NewRequest("POST", base+path, bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", contentType)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+
+	packed, err := msgpackMarshal(map[string]interface{}{"message": "packed"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	form := url.Values{"message": {"form"}, "user": {"alice"}}.Encode()
+	for _, tc := range []struct {
+		path        string
+		contentType string
+		body        []byte
+		token       string
+		status      int
+	}{
+		{"/app.access?time=1500000000", "application/json", []byte(`{"message":"single","status":200}`), "secret", http.StatusOK},
+		{"/app/batch", "application/json", []byte(`[{"message":"first"},{"message":"second"}]`), "secret", http.StatusOK},
+		{"/app", "application/msgpack", packed, "secret", http.StatusOK},
+		{"/app", "application/x-www-form-urlencoded", []byte(form), "secret", http.StatusOK},
+		{"/app", "application/json", []byte(`{"message":"no token"}`), "", http.StatusUnauthorized},
+		{"/app", "application/json", []byte(`{"message":"` + strings.Repeat("x", 100) + `"}`), "secret", http.StatusRequestEntityTooLarge},
+		{"/app", "application/json", []byte(`"not a record"`), "secret", http.StatusBadRequest},
+		{"/", "application/json", []byte(`{"message":"no tag"}`), "secret", http.StatusBadRequest},
+		{"/app", "text/csv", []byte(`a,b`), "secret", http.StatusUnsupportedMediaType},
+	} {
+		if !assert.Equal(t, tc.status, post(tc.path, tc.contentType, tc.body, tc.token), tc.path+" "+string(tc.body)) {
+			return
+		}
+	}
+	res, err := http.Get(base + "/app")
+	if !assert.NoError(t, err) {
+		return
+	}
+	res.Body.Close()
+	if !assert.Equal(t, http.StatusMethodNotAllowed, res.StatusCode) {
+		return
+	}
+
+	c.Shutdown()
+	<-done
+
+	if !assert.Len(t, messages, 5) {
+		return
+	}
+	expected := []struct {
+		tag     string
+		message string
+	}{
+		{"http.app.access", "single"},
+		{"http.app.batch", "first"},
+		{"http.app.batch", "second"},
+		{"http.app", "packed"},
+		{"http.app", "form"},
+	}
+	for i, e := range expected {
+		if !assert.Equal(t, e.tag, messages[i].Tag) {
+			return
+		}
+		if !assert.Equal(t, e.message, string(messages[i].Message)) {
+			return
+		}
+		if !assert.Equal(t, "127.0.0.1", messages[i].Host) {
+			return
+		}
+	}
+	if !assert.Equal(t, time.Unix(1500000000, 0), messages[0].Timestamp) {
+		return
+	}
+	if !assert.Equal(t, float64(200), messages[0].Fields["status"]) {
+		return
+	}
+	assert.Equal(t, "alice", messages[4].Fields["user"])
+}
+
+func TestInHTTPShutdown(t *testing.T) {
+	if pdebug.Enabled {
+		g := pdebug.Marker("TestInHTTPShutdown")
+		defer g.End()
+	}
+
+	config := &ConfigInHTTP{
+		Address: "127.0.0.1:0",
+	}
+	config.Restrict(&Config{FieldName: "message", HostFieldName: "hostname"})
+	in, err := NewInHTTP(config)
+	if !assert.NoError(t, err, "NewInHTTP should succeed") {
+		return
+	}
+	c, ctx := NewCircumstances()
+	c.RunProcess(ctx, in, false)
+	c.StartProcess.Wait()
+	go func() {
+		for range c.MonitorCh {
+		}
+	}()
+
+	// blocked in the handler, as nobody reads MessageCh
+	status := make(chan int, 1)
+	go func() {
+		body := strings.NewReader(`[{"message":"first"},{"message":"second"},{"message":"third"}]`)
+		res, err := http.Post("http://"+in.Addr().String()+"/app", "application/json", body)
+		if err != nil {
+			status <- 0
+			return
+		}
+		res.Body.Close()
+		status <- res.StatusCode
+	}()
+	for len(c.MessageCh) < cap(c.MessageCh) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	c.Shutdown()
+	select {
+	case s := <-status:
+		assert.Equal(t, http.StatusServiceUnavailable, s, "request in flight should be responded before shutdown")
+	case <-time.After(3 * time.Second):
+		t.Error("request in flight should be responded")
+	}
+}
@@ -0,0 +1,113 @@
+package chimera
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"os"
+	"time"
+)
+
+// InStdin ... read lines from stdin until EOF, and send them as FluentMessage.
+// After EOF, Run returns and InputProcess is done, so the agent shuts down when no other inputs are running.
+type InStdin struct {
+	tag           string
+	fieldName     string
+	hostFieldName string
+	host          string
+	parser        Parser
+	reader        io.Reader
+	messageCh     chan *FluentMessage
+	monitorCh     chan Stat
+}
+
+func NewInStdin(config *ConfigInStdin) (*InStdin, error) {
+	parser, err := NewParser(&config.ConfigParser)
+	if err != nil {
+		return nil, err
+	}
+	return &InStdin{
+		tag:           config.Tag,
+		fieldName:     config.FieldName,
+		hostFieldName: config.HostFieldName,
+		host:          config.Host,
+		parser:        parser,
+		reader:        os.Stdin,
+	}, nil
+}
+
+func (s *InStdin) Run(ctx context.Context, c *Circumstances) {
+	c.InputProcess.Add(1)
+	defer c.InputProcess.Done()
+
+	s.messageCh = c.MessageCh
+	s.monitorCh = c.MonitorCh
+
+	log.Println("[info] in_stdin: reading stdin. tag:", s.tag)
+	c.StartProcess.Done()
+
+	lineCh := make(chan []byte)
+	errCh := make(chan error, 1)
+	go func() {
+		r := bufio.NewReaderSize(s.reader, ReadBufferSize)
+		for {
+			line, err := r.ReadBytes('\n')
+			if len(line) > 0 {
+				select {
+				case lineCh <- bytes.TrimRight(line, "\r\n"):
+				case <-ctx.Done():
+					return
+				}
+			}
+			if err != nil {
+				errCh <- err
+				return
+			}
+		}
+	}()
+
+	var received int64
+	defer func() {
+		s.monitorCh <- &InputStat{
+			Input:  "stdin",
+			Counts: map[string]int64{"received": received},
+		}
+	}()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("[info] in_stdin: shutting down")
+			return
+		case err := <-errCh:
+			if err != io.EOF {
+				log.Println("[error] in_stdin: failed to read stdin.", err)
+			}
+			log.Println("[info] in_stdin: reached EOF. read", received, "lines")
+			return
+		case line := <-lineCh:
+			message := &FluentMessage{
+				Tag:           s.tag,
+				Timestamp:     time.Now(),
+				FieldName:     s.fieldName,
+				Message:       line,
+				HostFieldName: s.hostFieldName,
+				Host:          s.host,
+			}
+			if s.parser != nil {
+				if err := s.parser.Parse(message); err == errPartialLine {
+					continue
+				} else if err != nil {
+					log.Println("[debug] in_stdin: failed to parse line. sent as is.", err)
+				}
+			}
+			select {
+			case s.messageCh <- message:
+				received++
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package chimera
+
+import (
+	"strings"
+	"testing"
+
+	pdebug "github.com/lestrrat/go-pdebug"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInStdin(t *testing.T) {
+	if pdebug.Enabled {
+		g := pdebug.Marker("TestInStdin")
+		defer g.End()
+	}
+
+	config := &ConfigInStdin{
+		ConfigParser: ConfigParser{Format: "json"},
+	}
+	config.Restrict(&Config{FieldName: "message", HostFieldName: "hostname", Host: "localhost"})
+	in, err := NewInStdin(config)
+	if !assert.NoError(t, err, "NewInStdin should succeed") {
+		return
+	}
+	in.reader = strings.NewReader("{\"message\":\"first\",\"level\":\"info\"}\nsecond\r\nthird")
+
+	c, ctx := NewCircumstances()
+	c.RunProcess(ctx, in, false)
+	c.StartProcess.Wait()
+	go func() {
+		for range c.MonitorCh {
+		}
+	}()
+
+	var messages []*FluentMessage
+	done := make(chan struct{})
+	go func() {
+		for m := range c.MessageCh {
+			messages = append(messages, m)
+		}
+		close(done)
+	}()
+
+	// InputProcess is done by EOF
+	c.InputProcess.Wait()
+	c.Shutdown()
+	<-done
+
+	if !assert.Len(t, messages, 3) {
+		return
+	}
+	for i, expected := range []string{"first", "second", "third"} {
+		if !assert.Equal(t, expected, string(messages[i].Message)) {
+			return
+		}
+		if !assert.Equal(t, "stdin", messages[i].Tag) {
+			return
+		}
+		if !assert.Equal(t, "localhost", messages[i].Host) {
+			return
+		}
+	}
+	assert.Equal(t, map[string]interface{}{"level": "info"}, messages[0].Fields)
+}
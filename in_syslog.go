@@ -0,0 +1,266 @@
+package chimera
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// syslogMaxOctetCount is the largest octet count of a frame read.
+const syslogMaxOctetCount = "999999999"
+
+// InSyslog ... listen on UDP or TCP, and receive syslog messages in RFC3164 or RFC5424 format.
+// Messages over TCP are framed by octet-counting or newline. Tag is "<TagPrefix>.<facility>.<severity>".
+type InSyslog struct {
+	name           string
+	tagPrefix      string
+	fieldName      string
+	hostFieldName  string
+	maxMessageSize int
+	listener       net.Listener
+	packetConn     net.PacketConn
+	conns          map[net.Conn]struct{}
+	mu             sync.Mutex
+	wg             sync.WaitGroup
+	messageCh      chan *FluentMessage
+	monitorCh      chan Stat
+}
+
+func NewInSyslog(config *ConfigInSyslog) (*InSyslog, error) {
+	s := &InSyslog{
+		tagPrefix:      config.TagPrefix,
+		fieldName:      config.FieldName,
+		hostFieldName:  config.HostFieldName,
+		maxMessageSize: config.MaxMessageSize,
+		conns:          make(map[net.Conn]struct{}),
+	}
+	switch config.Network {
+	case "udp":
+		conn, err := net.ListenPacket("udp", config.Address)
+		if err != nil {
+			return nil, err
+		}
+		s.packetConn = conn
+		s.name = "syslog:udp:" + conn.LocalAddr().String()
+	case "tcp":
+		l, err := net.Listen("tcp", config.Address)
+		if err != nil {
+			return nil, err
+		}
+		s.listener = l
+		s.name = "syslog:tcp:" + l.Addr().String()
+	default:
+		return nil, fmt.Errorf("unknown syslog network: %q", config.Network)
+	}
+	return s, nil
+}
+
+// Addr returns the listening address.
+func (s *InSyslog) Addr() net.Addr {
+	if s.packetConn != nil {
+		return s.packetConn.LocalAddr()
+	}
+	return s.listener.Addr()
+}
+
+// Close closes the listener and connections.
+func (s *InSyslog) Close() {
+	if s.packetConn != nil {
+		s.packetConn.Close()
+	}
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+}
+
+func (s *InSyslog) Run(ctx context.Context, c *Circumstances) {
+	c.InputProcess.Add(1)
+	defer c.InputProcess.Done()
+
+	s.messageCh = c.MessageCh
+	s.monitorCh = c.MonitorCh
+
+	log.Println("[info] in_syslog: listening", s.name)
+	s.wg.Add(1)
+	if s.packetConn != nil {
+		go s.serveUDP(ctx)
+	} else {
+		go s.accept(ctx)
+	}
+	c.StartProcess.Done()
+
+	<-ctx.Done()
+	log.Println("[info] in_syslog: shutting down", s.name)
+	s.Close()
+	s.wg.Wait()
+}
+
+func (s *InSyslog) serveUDP(ctx context.Context) {
+	defer s.wg.Done()
+	buf := make([]byte, s.maxMessageSize)
+	for {
+		n, addr, err := s.packetConn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Println("[error] in_syslog: failed to read.", err)
+			}
+			return
+		}
+		if !s.emit(ctx, buf[:n], addr) {
+			return
+		}
+	}
+}
+
+func (s *InSyslog) accept(ctx context.Context) {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Println("[error] in_syslog: failed to accept.", err)
+			}
+			return
+		}
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+		if ctx.Err() != nil {
+			// accepted while closing
+			conn.Close()
+		}
+		s.wg.Add(1)
+		go s.handleConn(ctx, conn)
+	}
+}
+
+func (s *InSyslog) handleConn(ctx context.Context, conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		conn.Close()
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+	}()
+
+	r := bufio.NewReaderSize(conn, s.maxMessageSize)
+	for {
+		b, err := s.readFrame(r)
+		if err != nil {
+			if err != io.EOF && ctx.Err() == nil {
+				log.Println("[warn] in_syslog: failed to read frame.", err)
+			}
+			return
+		}
+		if len(bytes.TrimSpace(b)) == 0 {
+			continue
+		}
+		if !s.emit(ctx, b, conn.RemoteAddr()) {
+			return
+		}
+	}
+}
+
+// readFrame reads a message framed by octet-counting ("LEN SP MSG") or newline.
+func (s *InSyslog) readFrame(r *bufio.Reader) ([]byte, error) {
+	c, err := r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	if c[0] >= '1' && c[0] <= '9' {
+		digits := make([]byte, 0, len(syslogMaxOctetCount))
+		for {
+			c, err := r.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			if c == ' ' {
+				break
+			}
+			if c < '0' || c > '9' || len(digits) == len(syslogMaxOctetCount) {
+				return nil, fmt.Errorf("invalid octet count: %q", append(digits, c))
+			}
+			digits = append(digits, c)
+		}
+		n, err := strconv.Atoi(string(digits))
+		if err != nil {
+			return nil, fmt.Errorf("invalid octet count: %q", digits)
+		}
+		if n > s.maxMessageSize {
+			return nil, fmt.Errorf("message size %d exceeds limit %d", n, s.maxMessageSize)
+		}
+		b := make([]byte, n)
+		_, err = io.ReadFull(r, b)
+		return b, err
+	}
+	b, err := r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		return nil, fmt.Errorf("message exceeds limit %d", s.maxMessageSize)
+	}
+	if err == io.EOF && len(b) > 0 {
+		err = nil
+	}
+	return append([]byte{}, b...), err
+}
+
+// emit parses b and sends the message. It returns false when ctx is done.
+func (s *InSyslog) emit(ctx context.Context, b []byte, addr net.Addr) bool {
+	m, err := parseSyslogMessage(b, time.Now())
+	if err != nil {
+		log.Println("[warn] in_syslog: failed to parse message.", err)
+		s.monitorCh <- &InputStat{
+			Input:  s.name,
+			Counts: map[string]int64{"errors": 1},
+		}
+		return true
+	}
+	host := m.host
+	if host == "" {
+		host, _, _ = net.SplitHostPort(addr.String())
+	}
+	fields := map[string]interface{}{
+		"facility": syslogFacilities[m.facility],
+		"severity": syslogSeverities[m.severity],
+	}
+	for key, value := range map[string]string{
+		"ident":     m.ident,
+		"pid":       m.pid,
+		"msgid":     m.msgid,
+		"extradata": m.extradata,
+	} {
+		if value != "" {
+			fields[key] = value
+		}
+	}
+	message := &FluentMessage{
+		Tag:           s.tagPrefix + "." + syslogFacilities[m.facility] + "." + syslogSeverities[m.severity],
+		Timestamp:     m.timestamp,
+		FieldName:     s.fieldName,
+		Message:       []byte(m.message),
+		HostFieldName: s.hostFieldName,
+		Host:          host,
+		Fields:        fields,
+	}
+	select {
+	case s.messageCh <- message:
+	case <-ctx.Done():
+		return false
+	}
+	s.monitorCh <- &InputStat{
+		Input:  s.name,
+		Counts: map[string]int64{"received": 1},
+	}
+	return true
+}
@@ -0,0 +1,183 @@
+package chimera_test
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	chimera "github.com/kikumoto/fluent-agent-chimera"
+	pdebug "github.com/lestrrat/go-pdebug"
+	"github.com/stretchr/testify/assert"
+)
+
+func runInSyslog(t *testing.T, network string) (*chimera.InSyslog, *chimera.Circumstances) {
+	config := &chimera.ConfigInSyslog{
+		Network: network,
+		Address: "127.0.0.1:0",
+	}
+	config.Restrict(&chimera.Config{FieldName: "message", HostFieldName: "hostname"})
+	in, err := chimera.NewInSyslog(config)
+	if !assert.NoError(t, err, "NewInSyslog should succeed") {
+		return nil, nil
+	}
+	c, ctx := chimera.NewCircumstances()
+	c.RunProcess(ctx, in, false)
+	c.StartProcess.Wait()
+	go func() {
+		for range c.MonitorCh {
+		}
+	}()
+	return in, c
+}
+
+func receiveMessage(t *testing.T, c *chimera.Circumstances) *chimera.FluentMessage {
+	select {
+	case m := <-c.MessageCh:
+		return m
+	case <-time.After(3 * time.Second):
+		t.Error("message should be received")
+		return nil
+	}
+}
+
+func TestInSyslogTCP(t *testing.T) {
+	if pdebug.Enabled {
+		g := pdebug.Marker("TestInSyslogTCP")
+		defer g.End()
+	}
+
+	in, c := runInSyslog(t, "tcp")
+	if in == nil {
+		return
+	}
+	defer c.Shutdown()
+
+	conn, err := net.Dial("tcp", in.Addr().String())
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+
+	rfc5424 := `<165>1 2018-01-02T03:04:05.123Z web01 app 1234 ID47 [exampleSDID@32473 iut="3" eventSource="Application]"] started`
+	conn.Write([]byte(strconv.Itoa(len(rfc5424)) + " " + rfc5424))
+	conn.Write([]byte("<38>Jan  2 03:04:05 web02 sshd[999]: Accepted publickey\n"))
+
+	m := receiveMessage(t, c)
+	if m == nil {
+		return
+	}
+	if !assert.Equal(t, "syslog.local4.notice", m.Tag) {
+		return
+	}
+	if !assert.Equal(t, time.Date(2018, 1, 2, 3, 4, 5, 123000000, time.UTC), m.Timestamp.UTC()) {
+		return
+	}
+	if !assert.Equal(t, "web01", m.Host) {
+		return
+	}
+	if !assert.Equal(t, "started", string(m.Message)) {
+		return
+	}
+	if !assert.Equal(t, map[string]interface{}{
+		"facility":  "local4",
+		"severity":  "notice",
+		"ident":     "app",
+		"pid":       "1234",
+		"msgid":     "ID47",
+		"extradata": `[exampleSDID@32473 iut="3" eventSource="Application]"]`,
+	}, m.Fields) {
+		return
+	}
+
+	m = receiveMessage(t, c)
+	if m == nil {
+		return
+	}
+	if !assert.Equal(t, "syslog.auth.info", m.Tag) {
+		return
+	}
+	if !assert.Equal(t, "Accepted publickey", string(m.Message)) {
+		return
+	}
+	if !assert.Equal(t, "web02", m.Host) {
+		return
+	}
+	if !assert.Equal(t, time.January, m.Timestamp.Month()) {
+		return
+	}
+	assert.Equal(t, map[string]interface{}{
+		"facility": "auth",
+		"severity": "info",
+		"ident":    "sshd",
+		"pid":      "999",
+	}, m.Fields)
+}
+
+func TestInSyslogUDP(t *testing.T) {
+	if pdebug.Enabled {
+		g := pdebug.Marker("TestInSyslogUDP")
+		defer g.End()
+	}
+
+	in, c := runInSyslog(t, "udp")
+	if in == nil {
+		return
+	}
+	defer c.Shutdown()
+
+	conn, err := net.Dial("udp", in.Addr().String())
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+	conn.Write([]byte("no priority"))
+	conn.Write([]byte("<13>message without header"))
+
+	m := receiveMessage(t, c)
+	if m == nil {
+		return
+	}
+	if !assert.Equal(t, "syslog.user.notice", m.Tag) {
+		return
+	}
+	if !assert.Equal(t, "message without header", string(m.Message)) {
+		return
+	}
+	assert.Equal(t, "127.0.0.1", m.Host, "remote address should be used as host")
+}
+
+func TestInSyslogTCPInvalidOctetCount(t *testing.T) {
+	if pdebug.Enabled {
+		g := pdebug.Marker("TestInSyslogTCPInvalidOctetCount")
+		defer g.End()
+	}
+
+	in, c := runInSyslog(t, "tcp")
+	if in == nil {
+		return
+	}
+	defer c.Shutdown()
+
+	for _, frame := range []string{
+		strings.Repeat("9", 1000000),
+		"12x <38>Jan  2 03:04:05 web02 sshd[999]: Accepted publickey\n",
+	} {
+		conn, err := net.Dial("tcp", in.Addr().String())
+		if !assert.NoError(t, err) {
+			return
+		}
+		// the connection is closed without reading the rest
+		conn.Write([]byte(frame))
+		conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+		_, err = conn.Read(make([]byte, 1))
+		conn.Close()
+		if !assert.Error(t, err, "connection should be closed") {
+			return
+		}
+		if e, ok := err.(net.Error); ok && !assert.False(t, e.Timeout(), "connection should be closed before timeout") {
+			return
+		}
+	}
+}
@@ -22,8 +22,12 @@ package chimera
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
 	"log"
+	"os"
+	"sync"
 	"time"
 
 	fsnotify "github.com/fsnotify/fsnotify"
@@ -34,6 +38,12 @@ const (
 	InactiveTailInterval = 1000 * time.Millisecond
 )
 
+// errFileRotated is returned by watchFileEvent when the rotated file is drained.
+var errFileRotated = errors.New("file rotated")
+
+// followedFileExpire is how long the read position of a closed followed file is kept.
+const followedFileExpire = 10 * time.Minute
+
 type InTail struct {
 	filename      string
 	tag           string
@@ -41,6 +51,13 @@ type InTail struct {
 	pathFieldName string
 	hostFieldName string
 	host          string
+	parser        Parser
+	fields        map[string]interface{}
+	follow        bool
+	followed      *followedFiles
+	doneCh        chan<- *InTail
+	rotateWait    time.Duration
+	rotatedAt     time.Time
 	lastReadAt    time.Time
 	messageCh     chan *FluentMessage
 	monitorCh     chan Stat
@@ -54,6 +71,10 @@ func NewInTail(path string, config *ConfigLogfile, eventCh chan fsnotify.Event,
 	if err != nil {
 		return nil, err
 	}
+	parser, err := NewParser(&config.ConfigParser)
+	if err != nil {
+		return nil, err
+	}
 	return &InTail{
 		filename:      filename,
 		tag:           config.Tag,
@@ -61,6 +82,8 @@ func NewInTail(path string, config *ConfigLogfile, eventCh chan fsnotify.Event,
 		pathFieldName: config.PathFieldName,
 		hostFieldName: config.HostFieldName,
 		host:          config.Host,
+		parser:        parser,
+		rotateWait:    config.RotateWait.Duration,
 		lastReadAt:    time.Now(),
 		eventCh:       eventCh,
 		position:      position,
@@ -83,33 +106,77 @@ func (t *InTail) Run(ctx context.Context, c *Circumstances) {
 			log.Println("[info]", err)
 		} else {
 			log.Println("[error]", err)
+			t.notifyDone(ctx)
 		}
 		return
 	}
 	for {
 		err := t.watchFileEvent(f, ctx)
+		if err == errFileRotated {
+			log.Println("[info]", t.filename, "was rotated. Reopening")
+			t.closeFile(f)
+			t.rotatedAt = time.Time{}
+			if f, err = t.newTrailFile(SEEK_HEAD, ctx); err == nil {
+				continue
+			}
+		} else if _, ok := err.(Signal); err != nil && !ok {
+			t.closeFile(f)
+		}
 		if err != nil {
 			if _, ok := err.(Signal); ok {
 				log.Println("[info]", err)
 			} else {
 				log.Println("[warning]", err)
+				t.notifyDone(ctx)
 			}
 			return
 		}
 	}
 }
 
+// notifyDone tells the watcher that the tail has stopped by itself, e.g. the followed file has been removed.
+func (t *InTail) notifyDone(ctx context.Context) {
+	if t.doneCh == nil {
+		return
+	}
+	for {
+		select {
+		case t.doneCh <- t:
+			return
+		case <-t.eventCh:
+			// the watcher may be sending an event before receiving
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (t *InTail) closeFile(f *File) {
+	if t.followed != nil {
+		t.followed.release(t, f)
+	}
+	f.Close()
+}
+
 func (t *InTail) newTrailFile(startPos int64, ctx context.Context) (*File, error) {
 	seekTo := startPos
 	first := true
+	var missingSince time.Time
 	for {
 		f, err := openFile(t.filename, seekTo)
+		if err == nil && t.followed != nil {
+			if err = t.followed.acquire(t, f); err != nil {
+				f.Close()
+			}
+		}
 		if err == nil {
 			f.Tag = t.tag
 			f.FieldName = t.fieldName
 			f.PathFieldName = t.pathFieldName
 			f.HostFieldName = t.hostFieldName
 			f.Host = t.host
+			f.Parser = t.parser
+			f.Fields = t.fields
 			log.Println("[info] Trailing file:", f.Path, "tag:", f.Tag)
 			t.monitorCh <- f.UpdateStat()
 			return f, nil
@@ -120,6 +187,18 @@ func (t *InTail) newTrailFile(startPos int64, ctx context.Context) (*File, error
 			Position: int64(-1),
 			Error:    monitorError(err),
 		}
+		if t.follow && os.IsNotExist(err) {
+			// the followed file has been removed without a new one
+			if missingSince.IsZero() {
+				missingSince = time.Now()
+			} else if time.Since(missingSince) >= t.rotateWait {
+				t.monitorCh <- &FileStat{
+					File:  t.filename,
+					Close: true,
+				}
+				return nil, fmt.Errorf("%s was removed. Giving up", t.filename)
+			}
+		}
 		if first {
 			log.Println("[warn]", err, "Retrying...")
 		}
@@ -147,7 +226,7 @@ func (t *InTail) watchFileEvent(f *File, ctx context.Context) error {
 	case <-ctx.Done():
 		tm.Stop()
 		f.tailAndSend(t.messageCh, t.monitorCh)
-		f.Close()
+		t.closeFile(f)
 		return t.shutdownSignal()
 	case ev := <-t.eventCh:
 		tm.Stop()
@@ -161,10 +240,18 @@ func (t *InTail) watchFileEvent(f *File, ctx context.Context) error {
 	if err != nil {
 		return err
 	}
+	if t.follow && t.rotatedAt.IsZero() && f.isRotated() {
+		log.Println("[info]", t.filename, "was renamed or removed. Following until drained")
+		t.rotatedAt = time.Now()
+	}
 	if time.Now().Before(t.lastReadAt.Add(t.tailInterval)) {
 		return nil
 	}
+	position := f.Position
 	err = f.tailAndSend(t.messageCh, t.monitorCh)
+	if t.followed != nil {
+		t.followed.update(f)
+	}
 	t.lastReadAt = time.Now()
 	t.tailInterval = InactiveTailInterval
 
@@ -172,5 +259,93 @@ func (t *InTail) watchFileEvent(f *File, ctx context.Context) error {
 		log.Println("[error] tailAndSend error: ", err)
 		return err
 	}
+	if !t.rotatedAt.IsZero() && f.Position == position && time.Since(t.rotatedAt) >= t.rotateWait {
+		return errFileRotated
+	}
+	return nil
+}
+
+// followedFiles records read positions of files followed across rotation by their identity,
+// so that a rotated file matched again at another path is not read twice.
+type followedFiles struct {
+	mu    sync.Mutex
+	files []*followedFile
+}
+
+type followedFile struct {
+	stat       os.FileInfo
+	position   int64
+	holder     *InTail
+	releasedAt time.Time
+}
+
+func newFollowedFiles() *followedFiles {
+	return &followedFiles{}
+}
+
+// acquire marks f as read by t, and seeks f to the position read before.
+// It fails while f is read by another tail.
+func (ff *followedFiles) acquire(t *InTail, f *File) error {
+	ff.mu.Lock()
+	defer ff.mu.Unlock()
+	ff.expire(time.Now())
+	e := ff.find(f.lastStat)
+	if e == nil {
+		ff.files = append(ff.files, &followedFile{stat: f.lastStat, position: f.Position, holder: t})
+		return nil
+	}
+	if e.holder != nil && e.holder != t {
+		return fmt.Errorf("%s is read by another tail", f.Path)
+	}
+	// a larger position than the size means the inode was reused by a new file
+	if e.position > f.Position && e.position <= f.lastStat.Size() {
+		pos, err := f.Seek(e.position, os.SEEK_SET)
+		if err != nil {
+			return err
+		}
+		f.Position = pos
+		log.Println("[info]", f.Path, "was read before. Seeked to", pos)
+	}
+	e.stat = f.lastStat
+	e.holder = t
 	return nil
 }
+
+// update records the position of f.
+func (ff *followedFiles) update(f *File) {
+	ff.mu.Lock()
+	defer ff.mu.Unlock()
+	if e := ff.find(f.lastStat); e != nil {
+		e.position = f.Position
+	}
+}
+
+// release records the position of f closed by t.
+func (ff *followedFiles) release(t *InTail, f *File) {
+	ff.mu.Lock()
+	defer ff.mu.Unlock()
+	if e := ff.find(f.lastStat); e != nil && e.holder == t {
+		e.position = f.Position
+		e.holder = nil
+		e.releasedAt = time.Now()
+	}
+}
+
+func (ff *followedFiles) find(stat os.FileInfo) *followedFile {
+	for _, e := range ff.files {
+		if os.SameFile(e.stat, stat) {
+			return e
+		}
+	}
+	return nil
+}
+
+func (ff *followedFiles) expire(now time.Time) {
+	files := ff.files[:0]
+	for _, e := range ff.files {
+		if e.holder != nil || now.Sub(e.releasedAt) < followedFileExpire {
+			files = append(files, e)
+		}
+	}
+	ff.files = files
+}
@@ -179,3 +179,140 @@ func receiver(t *testing.T, ch chan *chimera.FluentMessage, resultCh chan string
 		}
 	}
 }
+
+func TestTrailRenamedFile(t *testing.T) {
+	if pdebug.Enabled {
+		g := pdebug.Marker("TestTrailRenamedFile")
+		defer g.End()
+	}
+
+	tmpdir, _ := ioutil.TempDir(os.TempDir(), "chimera-test")
+	defer os.RemoveAll(tmpdir)
+	filename := filepath.Join(tmpdir, "app.log")
+	file, _ := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY, 0644)
+
+	configLogFile := &chimera.ConfigLogfile{
+		Tag:              "test",
+		Basedir:          tmpdir,
+		TargetFileRegexp: &chimera.Regexp{Regexp: regexp.MustCompile(`^.+/app\.log$`)},
+		FieldName:        "message",
+		RotateWait:       chimera.Duration{Duration: 500 * time.Millisecond},
+	}
+	c, ctx := chimera.NewCircumstances()
+	watcher, err := chimera.NewWatcher([]*chimera.ConfigLogfile{configLogFile})
+	if !assert.NoError(t, err, `chimera.NewWatcher should succeed`) {
+		return
+	}
+	c.RunProcess(ctx, watcher, false)
+	c.StartProcess.Wait()
+
+	go func() {
+		time.Sleep(1 * time.Second) // wait for start Tail...
+		file.WriteString("before rename\n")
+		time.Sleep(100 * time.Millisecond)
+		os.Rename(filename, filename+".1")
+		// written to the renamed file until the writer reopens the path
+		file.WriteString("after rename\n")
+		file.Close()
+		time.Sleep(100 * time.Millisecond)
+		file, _ = os.OpenFile(filename, os.O_CREATE|os.O_WRONLY, 0644)
+		file.WriteString("new file\n")
+		file.WriteString(EOFMarker + "\n")
+		file.Close()
+	}()
+
+	var received []string
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case m := <-c.MessageCh:
+			received = append(received, string(m.Message))
+		case <-timeout:
+			t.Error("timed out. received", received)
+			c.Shutdown()
+			return
+		}
+		if received[len(received)-1] == EOFMarker {
+			break
+		}
+	}
+	assert.Equal(t, []string{"before rename", "after rename", "new file", EOFMarker}, received)
+	go func() {
+		for range c.MessageCh {
+		}
+	}()
+	c.Shutdown()
+}
+
+func TestTrailRenamedFileMatched(t *testing.T) {
+	if pdebug.Enabled {
+		g := pdebug.Marker("TestTrailRenamedFileMatched")
+		defer g.End()
+	}
+
+	tmpdir, _ := ioutil.TempDir(os.TempDir(), "chimera-test")
+	defer os.RemoveAll(tmpdir)
+	filename := filepath.Join(tmpdir, "app.log")
+	file, _ := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY, 0644)
+
+	configLogFile := &chimera.ConfigLogfile{
+		Tag:              "test",
+		Basedir:          tmpdir,
+		TargetFileRegexp: &chimera.Regexp{Regexp: regexp.MustCompile(`^.+/app\.log(?:\.\d+)?$`)},
+		FieldName:        "message",
+		RotateWait:       chimera.Duration{Duration: 500 * time.Millisecond},
+	}
+	c, ctx := chimera.NewCircumstances()
+	watcher, err := chimera.NewWatcher([]*chimera.ConfigLogfile{configLogFile})
+	if !assert.NoError(t, err, `chimera.NewWatcher should succeed`) {
+		return
+	}
+	c.RunProcess(ctx, watcher, false)
+	c.StartProcess.Wait()
+
+	go func() {
+		time.Sleep(1 * time.Second) // wait for start Tail...
+		file.WriteString("before rename\n")
+		time.Sleep(100 * time.Millisecond)
+		os.Rename(filename, filename+".1")
+		// written to the renamed file until the writer reopens the path
+		file.WriteString("after rename\n")
+		file.Close()
+		time.Sleep(100 * time.Millisecond)
+		file, _ = os.OpenFile(filename, os.O_CREATE|os.O_WRONLY, 0644)
+		file.WriteString("new file\n")
+		file.WriteString(EOFMarker + "\n")
+		file.Close()
+	}()
+
+	var received []string
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case m := <-c.MessageCh:
+			received = append(received, string(m.Message))
+		case <-timeout:
+			t.Error("timed out. received", received)
+			c.Shutdown()
+			return
+		}
+		if received[len(received)-1] == EOFMarker {
+			break
+		}
+	}
+	if !assert.Equal(t, []string{"before rename", "after rename", "new file", EOFMarker}, received) {
+		c.Shutdown()
+		return
+	}
+	// the renamed file matched again is not read from the head
+	select {
+	case m := <-c.MessageCh:
+		t.Error("unexpected message", string(m.Message))
+	case <-time.After(3 * time.Second):
+	}
+	go func() {
+		for range c.MessageCh {
+		}
+	}()
+	c.Shutdown()
+}
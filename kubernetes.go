@@ -0,0 +1,47 @@
+package chimera
+
+import (
+	"path/filepath"
+	"regexp"
+)
+
+// kubernetesFileNameRegexp matches the names of files under /var/log/containers,
+// "<pod>_<namespace>_<container>-<container id>.log".
+var kubernetesFileNameRegexp = regexp.MustCompile(`^([^_]+)_([^_]+)_(.+)-([0-9a-f]{64})\.log$`)
+
+// kubernetesMetadata is the metadata of the container encoded in the file name.
+type kubernetesMetadata struct {
+	podName       string
+	namespaceName string
+	containerName string
+	containerID   string
+}
+
+// parseKubernetesFileName extracts kubernetesMetadata from the base name of path.
+func parseKubernetesFileName(path string) (*kubernetesMetadata, bool) {
+	m := kubernetesFileNameRegexp.FindStringSubmatch(filepath.Base(path))
+	if m == nil {
+		return nil, false
+	}
+	return &kubernetesMetadata{
+		podName:       m[1],
+		namespaceName: m[2],
+		containerName: m[3],
+		containerID:   m[4],
+	}, true
+}
+
+// Fields returns the metadata as record fields.
+func (k *kubernetesMetadata) Fields() map[string]interface{} {
+	return map[string]interface{}{
+		"pod_name":       k.podName,
+		"namespace_name": k.namespaceName,
+		"container_name": k.containerName,
+		"container_id":   k.containerID,
+	}
+}
+
+// Tag returns tag followed by "<namespace>.<pod>.<container>".
+func (k *kubernetesMetadata) Tag(tag string) string {
+	return tag + "." + k.namespaceName + "." + k.podName + "." + k.containerName
+}
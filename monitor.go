@@ -39,19 +39,28 @@ const (
 )
 
 type Stats struct {
-	Sent   map[string]*SentStat `json:"sent"`
-	Files  map[string]*FileStat `json:"files"`
-	Server *ServerStat          `json:"server"`
-	mu     sync.Mutex
+	Sent    map[string]*SentStat              `json:"sent"`
+	Files   map[string]*FileStat              `json:"files"`
+	Server  *ServerStat                       `json:"server"`
+	Servers map[string]map[string]*ServerStat `json:"servers"`
+	Outputs map[string]map[string]int64       `json:"outputs"`
+	Inputs  map[string]map[string]int64       `json:"inputs"`
+	Execs   map[string]map[string]*ExecStat   `json:"execs"`
+	mu      sync.Mutex
 }
 
 type Stat interface {
 	ApplyTo(*Stats)
 }
 
+// ServerStat is the health of the server of a forward output.
+// Output is the tag pattern of the output, and Default is true for [Server].
 type ServerStat struct {
-	Alive bool   `json:"alive"`
-	Error string `json:"error"`
+	Output  string `json:"-"`
+	Address string `json:"-"`
+	Default bool   `json:"-"`
+	Alive   bool   `json:"alive"`
+	Error   string `json:"error"`
 }
 
 type SentStat struct {
@@ -59,6 +68,29 @@ type SentStat struct {
 	Sents int64  `json:"sents"`
 }
 
+// OutputStat adds Counts to the counters of the output.
+type OutputStat struct {
+	Output string
+	Counts map[string]int64
+}
+
+// InputStat adds Counts to the counters of the input.
+type InputStat struct {
+	Input  string
+	Counts map[string]int64
+}
+
+// ExecStat is the result of the last run of the command, keyed by Tag and Command.
+type ExecStat struct {
+	Tag       string    `json:"-"`
+	Command   string    `json:"-"`
+	ExitCode  int       `json:"exit_code"`
+	Error     string    `json:"error"`
+	LastRunAt time.Time `json:"last_run_at"`
+	Runs      int64     `json:"runs"`
+	Failures  int64     `json:"failures"`
+}
+
 type FileStat struct {
 	Tag      string `json:"tag"`
 	File     string `json:"-"`
@@ -80,7 +112,18 @@ func (s *FileStat) ApplyTo(ss *Stats) {
 func (s *ServerStat) ApplyTo(ss *Stats) {
 	ss.mu.Lock()
 	defer ss.mu.Unlock()
-	ss.Server = s
+	if s.Default {
+		ss.Server = s
+	}
+	if s.Address == "" {
+		return
+	}
+	servers, ok := ss.Servers[s.Output]
+	if !ok {
+		servers = make(map[string]*ServerStat)
+		ss.Servers[s.Output] = servers
+	}
+	servers[s.Address] = s
 }
 
 func (s *SentStat) ApplyTo(ss *Stats) {
@@ -93,6 +136,43 @@ func (s *SentStat) ApplyTo(ss *Stats) {
 	}
 }
 
+func (s *OutputStat) ApplyTo(ss *Stats) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	counts, ok := ss.Outputs[s.Output]
+	if !ok {
+		counts = make(map[string]int64)
+		ss.Outputs[s.Output] = counts
+	}
+	for key, n := range s.Counts {
+		counts[key] += n
+	}
+}
+
+func (s *InputStat) ApplyTo(ss *Stats) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	counts, ok := ss.Inputs[s.Input]
+	if !ok {
+		counts = make(map[string]int64)
+		ss.Inputs[s.Input] = counts
+	}
+	for key, n := range s.Counts {
+		counts[key] += n
+	}
+}
+
+func (s *ExecStat) ApplyTo(ss *Stats) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	execs, ok := ss.Execs[s.Tag]
+	if !ok {
+		execs = make(map[string]*ExecStat)
+		ss.Execs[s.Tag] = execs
+	}
+	execs[s.Command] = s
+}
+
 func (ss *Stats) WriteJSON(w http.ResponseWriter, v interface{}) {
 	ss.mu.Lock()
 	defer ss.mu.Unlock()
@@ -117,9 +197,13 @@ type Monitor struct {
 
 func NewMonitor(config *Config) (*Monitor, error) {
 	stats := &Stats{
-		Sent:   make(map[string]*SentStat),
-		Files:  make(map[string]*FileStat),
-		Server: &ServerStat{},
+		Sent:    make(map[string]*SentStat),
+		Files:   make(map[string]*FileStat),
+		Server:  &ServerStat{},
+		Servers: make(map[string]map[string]*ServerStat),
+		Outputs: make(map[string]map[string]int64),
+		Inputs:  make(map[string]map[string]int64),
+		Execs:   make(map[string]map[string]*ExecStat),
 	}
 	monitor := &Monitor{
 		stats: stats,
@@ -164,6 +248,22 @@ func (m *Monitor) Run(ctx context.Context, c *Circumstances) {
 		w.Header().Set("Content-Type", "application/json")
 		m.stats.WriteJSON(w, m.stats.Server)
 	})
+	http.HandleFunc("/servers", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		m.stats.WriteJSON(w, m.stats.Servers)
+	})
+	http.HandleFunc("/outputs", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		m.stats.WriteJSON(w, m.stats.Outputs)
+	})
+	http.HandleFunc("/inputs", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		m.stats.WriteJSON(w, m.stats.Inputs)
+	})
+	http.HandleFunc("/execs", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		m.stats.WriteJSON(w, m.stats.Execs)
+	})
 	http.HandleFunc("/system", stats_api.Handler)
 
 	go http.Serve(m.listener, nil)
@@ -91,3 +91,56 @@ func TestMonitorServer(t *testing.T) {
 		}
 	}
 }
+
+func TestServerStat(t *testing.T) {
+	if pdebug.Enabled {
+		g := pdebug.Marker("TestServerStat")
+		defer g.End()
+	}
+
+	stats := &chimera.Stats{
+		Server:  &chimera.ServerStat{},
+		Servers: make(map[string]map[string]*chimera.ServerStat),
+	}
+	for _, s := range []*chimera.ServerStat{
+		{Output: "**", Address: "tcp:127.0.0.1:24224", Default: true, Alive: true},
+		{Output: "nginx.*", Address: "tcp:127.0.0.1:24224", Error: "nginx error"},
+		{Output: "app.*", Address: "tcp:10.0.0.1:24224", Error: "app error"},
+	} {
+		s.ApplyTo(stats)
+	}
+
+	if !assert.True(t, stats.Server.Alive, "/server should be the server of [Server]") {
+		return
+	}
+	if !assert.Len(t, stats.Servers, 3) {
+		return
+	}
+	assert.True(t, stats.Servers["**"]["tcp:127.0.0.1:24224"].Alive)
+	assert.Equal(t, "nginx error", stats.Servers["nginx.*"]["tcp:127.0.0.1:24224"].Error)
+	assert.Equal(t, "app error", stats.Servers["app.*"]["tcp:10.0.0.1:24224"].Error)
+}
+
+func TestExecStat(t *testing.T) {
+	if pdebug.Enabled {
+		g := pdebug.Marker("TestExecStat")
+		defer g.End()
+	}
+
+	stats := &chimera.Stats{
+		Execs: make(map[string]map[string]*chimera.ExecStat),
+	}
+	// the same command run for different tags
+	for _, s := range []*chimera.ExecStat{
+		{Tag: "disk.root", Command: "df -k", ExitCode: 0},
+		{Tag: "disk.data", Command: "df -k", ExitCode: 1},
+	} {
+		s.ApplyTo(stats)
+	}
+
+	if !assert.Len(t, stats.Execs, 2) {
+		return
+	}
+	assert.Equal(t, 0, stats.Execs["disk.root"]["df -k"].ExitCode)
+	assert.Equal(t, 1, stats.Execs["disk.data"]["df -k"].ExitCode)
+}
@@ -0,0 +1,508 @@
+package chimera
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// The msgpack codec is written here, instead of using go-msgpack which is pinned for go-fluent-client.
+// in_forward decodes msgpack received from the network, so the declared length of each string and
+// container has to be checked against MaxChunkSize before allocating, and nesting is limited by
+// msgpackMaxDepth. go-msgpack has no limits of the size nor the nesting depth of a decoded value.
+// fluentd EventTime is decoded into time.Time, and encoded from it.
+
+var errMsgpackTooLarge = errors.New("msgpack: length exceeds 32 bits")
+
+// msgpackEncoder is a minimal msgpack encoder for records built from FluentMessage.
+// time.Time is encoded as fluentd EventTime extension.
+type msgpackEncoder struct {
+	buf bytes.Buffer
+}
+
+func msgpackMarshal(v interface{}) ([]byte, error) {
+	e := &msgpackEncoder{}
+	if err := e.encode(v); err != nil {
+		return nil, err
+	}
+	return e.buf.Bytes(), nil
+}
+
+func (e *msgpackEncoder) encode(v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		e.buf.WriteByte(0xc0)
+	case bool:
+		if v {
+			e.buf.WriteByte(0xc3)
+		} else {
+			e.buf.WriteByte(0xc2)
+		}
+	case int:
+		e.writeInt(int64(v))
+	case int8:
+		e.writeInt(int64(v))
+	case int16:
+		e.writeInt(int64(v))
+	case int32:
+		e.writeInt(int64(v))
+	case int64:
+		e.writeInt(v)
+	case uint:
+		e.writeUint(uint64(v))
+	case uint8:
+		e.writeUint(uint64(v))
+	case uint16:
+		e.writeUint(uint64(v))
+	case uint32:
+		e.writeUint(uint64(v))
+	case uint64:
+		e.writeUint(v)
+	case float32:
+		e.buf.WriteByte(0xca)
+		e.writeBE(math.Float32bits(v))
+	case float64:
+		e.buf.WriteByte(0xcb)
+		e.writeBE(math.Float64bits(v))
+	case string:
+		if uint64(len(v)) > math.MaxUint32 {
+			return errMsgpackTooLarge
+		}
+		e.writeString(v)
+	case []byte:
+		if uint64(len(v)) > math.MaxUint32 {
+			return errMsgpackTooLarge
+		}
+		e.writeBinary(v)
+	case time.Time:
+		e.writeEventTime(v)
+	case []interface{}:
+		if uint64(len(v)) > math.MaxUint32 {
+			return errMsgpackTooLarge
+		}
+		e.writeArrayHeader(len(v))
+		for _, item := range v {
+			if err := e.encode(item); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		if uint64(len(v)) > math.MaxUint32 {
+			return errMsgpackTooLarge
+		}
+		e.writeMapHeader(len(v))
+		for _, key := range keys {
+			e.writeString(key)
+			if err := e.encode(v[key]); err != nil {
+				return err
+			}
+		}
+	case map[string]string:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		e.writeMapHeader(len(v))
+		for _, key := range keys {
+			e.writeString(key)
+			e.writeString(v[key])
+		}
+	default:
+		return fmt.Errorf("msgpack: unsupported type %s", reflect.TypeOf(v))
+	}
+	return nil
+}
+
+func (e *msgpackEncoder) writeBE(v interface{}) {
+	binary.Write(&e.buf, binary.BigEndian, v)
+}
+
+func (e *msgpackEncoder) writeInt(v int64) {
+	switch {
+	case v >= 0:
+		e.writeUint(uint64(v))
+	case v >= -32:
+		e.buf.WriteByte(byte(v))
+	case v >= math.MinInt8:
+		e.buf.WriteByte(0xd0)
+		e.writeBE(int8(v))
+	case v >= math.MinInt16:
+		e.buf.WriteByte(0xd1)
+		e.writeBE(int16(v))
+	case v >= math.MinInt32:
+		e.buf.WriteByte(0xd2)
+		e.writeBE(int32(v))
+	default:
+		e.buf.WriteByte(0xd3)
+		e.writeBE(v)
+	}
+}
+
+func (e *msgpackEncoder) writeUint(v uint64) {
+	switch {
+	case v <= 0x7f:
+		e.buf.WriteByte(byte(v))
+	case v <= math.MaxUint8:
+		e.buf.WriteByte(0xcc)
+		e.buf.WriteByte(byte(v))
+	case v <= math.MaxUint16:
+		e.buf.WriteByte(0xcd)
+		e.writeBE(uint16(v))
+	case v <= math.MaxUint32:
+		e.buf.WriteByte(0xce)
+		e.writeBE(uint32(v))
+	default:
+		e.buf.WriteByte(0xcf)
+		e.writeBE(v)
+	}
+}
+
+func (e *msgpackEncoder) writeString(s string) {
+	n := len(s)
+	switch {
+	case n <= 31:
+		e.buf.WriteByte(0xa0 | byte(n))
+	case n <= math.MaxUint8:
+		e.buf.WriteByte(0xd9)
+		e.buf.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		e.buf.WriteByte(0xda)
+		e.writeBE(uint16(n))
+	default:
+		e.buf.WriteByte(0xdb)
+		e.writeBE(uint32(n))
+	}
+	e.buf.WriteString(s)
+}
+
+func (e *msgpackEncoder) writeBinary(b []byte) {
+	n := len(b)
+	switch {
+	case n <= math.MaxUint8:
+		e.buf.WriteByte(0xc4)
+		e.buf.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		e.buf.WriteByte(0xc5)
+		e.writeBE(uint16(n))
+	default:
+		e.buf.WriteByte(0xc6)
+		e.writeBE(uint32(n))
+	}
+	e.buf.Write(b)
+}
+
+func (e *msgpackEncoder) writeArrayHeader(n int) {
+	switch {
+	case n <= 15:
+		e.buf.WriteByte(0x90 | byte(n))
+	case n <= math.MaxUint16:
+		e.buf.WriteByte(0xdc)
+		e.writeBE(uint16(n))
+	default:
+		e.buf.WriteByte(0xdd)
+		e.writeBE(uint32(n))
+	}
+}
+
+func (e *msgpackEncoder) writeMapHeader(n int) {
+	switch {
+	case n <= 15:
+		e.buf.WriteByte(0x80 | byte(n))
+	case n <= math.MaxUint16:
+		e.buf.WriteByte(0xde)
+		e.writeBE(uint16(n))
+	default:
+		e.buf.WriteByte(0xdf)
+		e.writeBE(uint32(n))
+	}
+}
+
+// writeEventTime writes fluentd EventTime. (ext type 0, fixext8)
+func (e *msgpackEncoder) writeEventTime(t time.Time) {
+	e.buf.WriteByte(0xd7)
+	e.buf.WriteByte(0x00)
+	e.writeBE(uint32(t.Unix()))
+	e.writeBE(uint32(t.Nanosecond()))
+}
+
+// msgpackMaxDepth is the max nesting depth of arrays and maps accepted by msgpackDecoder.
+const msgpackMaxDepth = 64
+
+// msgpackDecoder is a minimal msgpack decoder for events received by forward protocol.
+// Map is decoded to map[string]interface{}, and fluentd EventTime extension to time.Time.
+// A value decoded by Decode is limited to maxSize bytes in total (0 means no limit),
+// and to msgpackMaxDepth levels of nesting.
+type msgpackDecoder struct {
+	r       *bufio.Reader
+	maxSize int
+	read    int
+	start   int
+}
+
+func newMsgpackDecoder(r io.Reader, maxSize int) *msgpackDecoder {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	return &msgpackDecoder{r: br, maxSize: maxSize}
+}
+
+// Decode decodes a value.
+func (d *msgpackDecoder) Decode() (interface{}, error) {
+	d.start = d.read
+	return d.decode(0)
+}
+
+// BytesRead returns the total bytes read by the decoder.
+func (d *msgpackDecoder) BytesRead() int {
+	return d.read
+}
+
+func (d *msgpackDecoder) decode(depth int) (interface{}, error) {
+	c, err := d.readByte()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c&0xf0 == 0x80:
+		return d.decodeMap(int(c&0x0f), depth)
+	case c&0xf0 == 0x90:
+		return d.decodeArray(int(c&0x0f), depth)
+	case c&0xe0 == 0xa0:
+		return d.decodeString(int(c & 0x1f))
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := d.readLength(c - 0xc4)
+		if err != nil {
+			return nil, err
+		}
+		return d.readBytes(n)
+	case 0xc7, 0xc8, 0xc9:
+		n, err := d.readLength(c - 0xc7)
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeExt(n)
+	case 0xca:
+		var v uint32
+		err := d.readBE(&v)
+		return float64(math.Float32frombits(v)), err
+	case 0xcb:
+		var v uint64
+		err := d.readBE(&v)
+		return math.Float64frombits(v), err
+	case 0xcc:
+		var v uint8
+		err := d.readBE(&v)
+		return int64(v), err
+	case 0xcd:
+		var v uint16
+		err := d.readBE(&v)
+		return int64(v), err
+	case 0xce:
+		var v uint32
+		err := d.readBE(&v)
+		return int64(v), err
+	case 0xcf:
+		var v uint64
+		err := d.readBE(&v)
+		if v > math.MaxInt64 {
+			return v, err
+		}
+		return int64(v), err
+	case 0xd0:
+		var v int8
+		err := d.readBE(&v)
+		return int64(v), err
+	case 0xd1:
+		var v int16
+		err := d.readBE(&v)
+		return int64(v), err
+	case 0xd2:
+		var v int32
+		err := d.readBE(&v)
+		return int64(v), err
+	case 0xd3:
+		var v int64
+		err := d.readBE(&v)
+		return v, err
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return d.decodeExt(1 << (c - 0xd4))
+	case 0xd9, 0xda, 0xdb:
+		n, err := d.readLength(c - 0xd9)
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeString(n)
+	case 0xdc, 0xdd:
+		n, err := d.readLength(c - 0xdc + 1)
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeArray(n, depth)
+	case 0xde, 0xdf:
+		n, err := d.readLength(c - 0xde + 1)
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeMap(n, depth)
+	}
+	return nil, fmt.Errorf("msgpack: invalid format 0x%02x", c)
+}
+
+// consume counts n bytes to be read, and fails if the value exceeds maxSize.
+func (d *msgpackDecoder) consume(n int) error {
+	if d.maxSize > 0 && n > d.maxSize-(d.read-d.start) {
+		return fmt.Errorf("msgpack: data exceeds limit %d", d.maxSize)
+	}
+	d.read += n
+	return nil
+}
+
+func (d *msgpackDecoder) readByte() (byte, error) {
+	if err := d.consume(1); err != nil {
+		return 0, err
+	}
+	return d.r.ReadByte()
+}
+
+func (d *msgpackDecoder) readBE(v interface{}) error {
+	if err := d.consume(binary.Size(v)); err != nil {
+		return err
+	}
+	return binary.Read(d.r, binary.BigEndian, v)
+}
+
+// readLength reads length of 1, 2 or 4 bytes by size 0, 1 or 2.
+func (d *msgpackDecoder) readLength(size byte) (int, error) {
+	switch size {
+	case 0:
+		var n uint8
+		err := d.readBE(&n)
+		return int(n), err
+	case 1:
+		var n uint16
+		err := d.readBE(&n)
+		return int(n), err
+	default:
+		var n uint32
+		err := d.readBE(&n)
+		return int(n), err
+	}
+}
+
+func (d *msgpackDecoder) readBytes(n int) ([]byte, error) {
+	if err := d.consume(n); err != nil {
+		return nil, err
+	}
+	b := make([]byte, n)
+	_, err := io.ReadFull(d.r, b)
+	return b, err
+}
+
+func (d *msgpackDecoder) decodeString(n int) (interface{}, error) {
+	b, err := d.readBytes(n)
+	return string(b), err
+}
+
+// checkContainer fails if the container of n values is nested too deep,
+// or cannot fit in maxSize as each value takes 1 byte at least.
+func (d *msgpackDecoder) checkContainer(n int, depth int) error {
+	if depth >= msgpackMaxDepth {
+		return fmt.Errorf("msgpack: nesting exceeds limit %d", msgpackMaxDepth)
+	}
+	if d.maxSize > 0 && n > d.maxSize-(d.read-d.start) {
+		return fmt.Errorf("msgpack: data exceeds limit %d", d.maxSize)
+	}
+	return nil
+}
+
+func (d *msgpackDecoder) decodeArray(n int, depth int) (interface{}, error) {
+	if err := d.checkContainer(n, depth); err != nil {
+		return nil, err
+	}
+	v := make([]interface{}, 0, minInt(n, 1024))
+	for i := 0; i < n; i++ {
+		item, err := d.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		v = append(v, item)
+	}
+	return v, nil
+}
+
+func (d *msgpackDecoder) decodeMap(n int, depth int) (interface{}, error) {
+	if err := d.checkContainer(2*n, depth); err != nil {
+		return nil, err
+	}
+	v := make(map[string]interface{}, minInt(n, 1024))
+	for i := 0; i < n; i++ {
+		key, err := d.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		value, err := d.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		switch k := key.(type) {
+		case string:
+			v[k] = value
+		case []byte:
+			v[string(k)] = value
+		default:
+			v[fmt.Sprint(k)] = value
+		}
+	}
+	return v, nil
+}
+
+// decodeExt decodes ext of n bytes data. EventTime (type 0) is decoded to time.Time,
+// and the other types to []byte.
+func (d *msgpackDecoder) decodeExt(n int) (interface{}, error) {
+	typ, err := d.readByte()
+	if err != nil {
+		return nil, err
+	}
+	b, err := d.readBytes(n)
+	if err != nil {
+		return nil, err
+	}
+	if typ == 0 && n == 8 {
+		return time.Unix(int64(binary.BigEndian.Uint32(b[0:4])), int64(binary.BigEndian.Uint32(b[4:8]))), nil
+	}
+	return b, nil
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
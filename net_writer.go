@@ -0,0 +1,60 @@
+package chimera
+
+import (
+	"crypto/tls"
+	"net"
+	"time"
+)
+
+// netWriter writes to a connection of network and address.
+// The connection is established lazily, and closed on write error to be reconnected at next Write.
+// If tlsConfig is set, the connection is wrapped by TLS.
+type netWriter struct {
+	network   string
+	address   string
+	timeout   time.Duration
+	tlsConfig *tls.Config
+	conn      net.Conn
+}
+
+func newNetWriter(network, address string, timeout time.Duration) *netWriter {
+	return &netWriter{
+		network: network,
+		address: address,
+		timeout: timeout,
+	}
+}
+
+func (w *netWriter) dial() (net.Conn, error) {
+	if w.tlsConfig != nil {
+		return tls.DialWithDialer(&net.Dialer{Timeout: w.timeout}, w.network, w.address, w.tlsConfig)
+	}
+	return net.DialTimeout(w.network, w.address, w.timeout)
+}
+
+func (w *netWriter) Write(b []byte) (int, error) {
+	if w.conn == nil {
+		conn, err := w.dial()
+		if err != nil {
+			return 0, err
+		}
+		w.conn = conn
+	}
+	if w.timeout > 0 {
+		w.conn.SetWriteDeadline(time.Now().Add(w.timeout))
+	}
+	n, err := w.conn.Write(b)
+	if err != nil {
+		w.Close()
+	}
+	return n, err
+}
+
+func (w *netWriter) Close() error {
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
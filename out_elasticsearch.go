@@ -0,0 +1,181 @@
+package chimera
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// OutElasticsearch ... recieve FluentMessage from channel, and index them in batches by bulk API.
+// Items failed by 429 or 5xx are retried, and the others are dropped.
+type OutElasticsearch struct {
+	client          *httpClient
+	bulkURL         string
+	name            string
+	index           string
+	indexTimeFormat string
+	typeName        string
+	timestampKey    string
+	batchSize       int
+	flushInterval   time.Duration
+	messageCh       chan *FluentMessage
+	monitorCh       chan Stat
+}
+
+type bulkResponse struct {
+	Errors bool                                `json:"errors"`
+	Items  []map[string]*bulkResponseItemValue `json:"items"`
+}
+
+type bulkResponseItemValue struct {
+	Status int             `json:"status"`
+	Error  json.RawMessage `json:"error"`
+}
+
+func NewOutElasticsearch(config *ConfigElasticsearch) (*OutElasticsearch, error) {
+	client, err := newHTTPClient(&config.ConfigHTTPClient)
+	if err != nil {
+		return nil, err
+	}
+	return &OutElasticsearch{
+		client:          client,
+		bulkURL:         strings.TrimRight(config.URL, "/") + "/_bulk",
+		name:            "elasticsearch:" + monitorURL(config.URL),
+		index:           config.Index,
+		indexTimeFormat: config.IndexTimeFormat,
+		typeName:        config.TypeName,
+		timestampKey:    config.TimestampKey,
+		batchSize:       config.BatchSize,
+		flushInterval:   config.FlushInterval.Duration,
+	}, nil
+}
+
+func (o *OutElasticsearch) SetMessageCh(ch chan *FluentMessage) {
+	o.messageCh = ch
+}
+
+func (o *OutElasticsearch) Run(ctx context.Context, c *Circumstances) {
+	log.Println("[info] out_elasticsearch: starting")
+	defer log.Println("[info] out_elasticsearch: exiting")
+
+	c.OutputProcess.Add(1)
+	defer c.OutputProcess.Done()
+	if o.messageCh == nil {
+		o.messageCh = c.MessageCh
+	}
+	o.monitorCh = c.MonitorCh
+
+	c.StartProcess.Done()
+
+	runBatch(o.messageCh, o.batchSize, o.flushInterval, o.flush)
+	log.Println("[info] out_elasticsearch: message channel closed")
+}
+
+func (o *OutElasticsearch) flush(messages []*FluentMessage) {
+	wait := o.client.retryWait
+	for retries := 0; len(messages) > 0; retries++ {
+		retry, err := o.bulk(messages)
+		if err != nil {
+			log.Println("[error] out_elasticsearch: bulk request failed. dropped", len(messages), "records.", err)
+			o.monitorCh <- &OutputStat{
+				Output: o.name,
+				Counts: map[string]int64{"failed": int64(len(messages))},
+			}
+			return
+		}
+		if len(retry) == 0 {
+			return
+		}
+		if retries >= o.client.maxRetries {
+			log.Println("[error] out_elasticsearch: retry limit exceeded. dropped", len(retry), "records.")
+			o.monitorCh <- &OutputStat{
+				Output: o.name,
+				Counts: map[string]int64{"failed": int64(len(retry))},
+			}
+			return
+		}
+		log.Println("[warn] out_elasticsearch: retrying", len(retry), "records...")
+		o.monitorCh <- &OutputStat{
+			Output: o.name,
+			Counts: map[string]int64{"retried": int64(len(retry))},
+		}
+		time.Sleep(wait)
+		wait *= 2
+		messages = retry
+	}
+}
+
+// bulk sends messages by bulk API and returns messages to be retried.
+func (o *OutElasticsearch) bulk(messages []*FluentMessage) ([]*FluentMessage, error) {
+	body, err := o.encode(messages)
+	if err != nil {
+		return nil, err
+	}
+	resBody, err := o.client.post(o.bulkURL, "application/x-ndjson", body)
+	if err != nil {
+		return nil, err
+	}
+	var res bulkResponse
+	if err := json.Unmarshal(resBody, &res); err != nil {
+		return nil, err
+	}
+	if len(res.Items) != len(messages) {
+		return nil, fmt.Errorf("bulk response has %d items for %d records", len(res.Items), len(messages))
+	}
+
+	var retry []*FluentMessage
+	var indexed, failed int64
+	for i, item := range res.Items {
+		var result *bulkResponseItemValue
+		for _, v := range item {
+			result = v
+		}
+		switch {
+		case result == nil:
+			failed++
+		case result.Status >= 200 && result.Status < 300:
+			indexed++
+			o.monitorCh <- &SentStat{
+				Tag:   messages[i].Tag,
+				Sents: 1,
+			}
+		case result.Status == 429 || result.Status >= 500:
+			retry = append(retry, messages[i])
+		default:
+			failed++
+			log.Printf("[warn] out_elasticsearch: failed to index a record. status: %d, error: %s\n", result.Status, result.Error)
+		}
+	}
+	o.monitorCh <- &OutputStat{
+		Output: o.name,
+		Counts: map[string]int64{"indexed": indexed, "failed": failed},
+	}
+	return retry, nil
+}
+
+func (o *OutElasticsearch) encode(messages []*FluentMessage) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, m := range messages {
+		// index names must be lowercase
+		meta := map[string]string{
+			"_index": strings.ToLower(expandOutputTemplate(o.index, m.Tag, m.Timestamp, o.indexTimeFormat)),
+		}
+		if o.typeName != "" {
+			meta["_type"] = o.typeName
+		}
+		if err := encoder.Encode(map[string]interface{}{"index": meta}); err != nil {
+			return nil, err
+		}
+		record := jsonRecord(m)
+		record[o.timestampKey] = m.Timestamp.Format(time.RFC3339Nano)
+		if err := encoder.Encode(record); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,155 @@
+package chimera_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	chimera "github.com/kikumoto/fluent-agent-chimera"
+	pdebug "github.com/lestrrat/go-pdebug"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutElasticsearch(t *testing.T) {
+	if pdebug.Enabled {
+		g := pdebug.Marker("TestOutElasticsearch")
+		defer g.End()
+	}
+
+	var mu sync.Mutex
+	var lines [][]map[string]interface{}
+	first := true
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.URL.Path != "/_bulk" {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		var req []map[string]interface{}
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			var v map[string]interface{}
+			if err := json.Unmarshal(scanner.Bytes(), &v); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			req = append(req, v)
+		}
+		lines = append(lines, req)
+
+		// first request: 1st item succeeds, 2nd is rejected, 3rd is retried.
+		items := []interface{}{}
+		for i := 0; i < len(req)/2; i++ {
+			status := 201
+			if first && i == 1 {
+				status = 400
+			} else if first && i == 2 {
+				status = 429
+			}
+			items = append(items, map[string]interface{}{
+				"index": map[string]interface{}{"status": status},
+			})
+		}
+		first = false
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"errors": true,
+			"items":  items,
+		})
+	}))
+	defer s.Close()
+
+	config := &chimera.ConfigElasticsearch{
+		ConfigHTTPClient: chimera.ConfigHTTPClient{
+			URL:       strings.Replace(s.URL, "://", "://user:secret@", 1) + "/",
+			RetryWait: chimera.Duration{Duration: 10 * time.Millisecond},
+			BatchSize: 3,
+		},
+		Index: "logs-${tag}-{date}",
+	}
+	config.Restrict(&chimera.Config{})
+	out, err := chimera.NewOutElasticsearch(config)
+	if !assert.NoError(t, err, "NewOutElasticsearch should succeed") {
+		return
+	}
+
+	c, ctx := chimera.NewCircumstances()
+	c.RunProcess(ctx, out, false)
+	c.StartProcess.Wait()
+	var outputs []string
+	go func() {
+		for s := range c.MonitorCh {
+			if s, ok := s.(*chimera.OutputStat); ok {
+				mu.Lock()
+				outputs = append(outputs, s.Output)
+				mu.Unlock()
+			}
+		}
+	}()
+
+	ts := time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, m := range []string{"first", "second", "third"} {
+		c.MessageCh <- &chimera.FluentMessage{
+			Tag:           "App",
+			Timestamp:     ts,
+			FieldName:     "message",
+			Message:       []byte(m),
+			PathFieldName: "path",
+			Path:          "/path/to/file",
+			HostFieldName: "host",
+			Host:          "localhost",
+		}
+	}
+	c.Shutdown()
+	// wait for stats sent until shutdown
+	for i := 0; i < 100; i++ {
+		mu.Lock()
+		n := len(outputs)
+		mu.Unlock()
+		if n > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !assert.Len(t, lines, 2, "rejected item by 429 should be retried") {
+		return
+	}
+	if !assert.Len(t, lines[0], 6) {
+		return
+	}
+	if !assert.Equal(t, map[string]interface{}{
+		"index": map[string]interface{}{"_index": "logs-app-2018.01.02"},
+	}, lines[0][0]) {
+		return
+	}
+	if !assert.Equal(t, map[string]interface{}{
+		"message":    "first",
+		"path":       "/path/to/file",
+		"host":       "localhost",
+		"@timestamp": "2018-01-02T03:04:05Z",
+	}, lines[0][1]) {
+		return
+	}
+	if !assert.Len(t, lines[1], 2) {
+		return
+	}
+	if !assert.Equal(t, "third", lines[1][1]["message"]) {
+		return
+	}
+	if !assert.NotEmpty(t, outputs) {
+		return
+	}
+	for _, output := range outputs {
+		if !assert.NotContains(t, output, "secret", "credentials should not be shown on the monitor") {
+			return
+		}
+	}
+}
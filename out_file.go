@@ -0,0 +1,218 @@
+package chimera
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	outFileIdleTimeout = 1 * time.Minute
+)
+
+var (
+	ltsvEscaper = strings.NewReplacer("\t", "\\t", "\n", "\\n", "\r", "\\r")
+)
+
+// OutFile ... recieve FluentMessage from channel, and write it to local files.
+type OutFile struct {
+	path           string
+	fileTimeFormat string
+	format         string
+	maxSize        int64
+	maxFiles       int
+	files          map[string]*outFileHandle
+	lastCloseIdle  time.Time
+	messageCh      chan *FluentMessage
+	monitorCh      chan Stat
+}
+
+type outFileHandle struct {
+	*os.File
+	size      int64
+	lastWrite time.Time
+}
+
+func NewOutFile(config *ConfigOutFile) (*OutFile, error) {
+	if config.Path == "" {
+		return nil, fmt.Errorf("file output requires Path")
+	}
+	switch config.Format {
+	case "json", "ltsv", "raw":
+	default:
+		return nil, fmt.Errorf("unknown file format: %q", config.Format)
+	}
+	if config.MaxFiles < 1 {
+		return nil, fmt.Errorf("MaxFiles must be greater than 0")
+	}
+	return &OutFile{
+		path:           config.Path,
+		fileTimeFormat: config.FileTimeFormat,
+		format:         config.Format,
+		maxSize:        config.MaxSize,
+		maxFiles:       config.MaxFiles,
+		files:          make(map[string]*outFileHandle),
+		lastCloseIdle:  time.Now(),
+	}, nil
+}
+
+func (o *OutFile) SetMessageCh(ch chan *FluentMessage) {
+	o.messageCh = ch
+}
+
+func (o *OutFile) Run(ctx context.Context, c *Circumstances) {
+	log.Println("[info] out_file: starting")
+	defer log.Println("[info] out_file: exiting")
+
+	c.OutputProcess.Add(1)
+	defer c.OutputProcess.Done()
+	if o.messageCh == nil {
+		o.messageCh = c.MessageCh
+	}
+	o.monitorCh = c.MonitorCh
+
+	c.StartProcess.Done()
+
+	for message := range o.messageCh {
+		if err := o.write(message); err != nil {
+			log.Println("[error] out_file: failed to write message.", err)
+			continue
+		}
+		o.monitorCh <- &SentStat{
+			Tag:   message.Tag,
+			Sents: 1,
+		}
+	}
+	log.Println("[info] out_file: message channel closed")
+	o.Close()
+}
+
+// Close closes all opened files.
+func (o *OutFile) Close() {
+	for path, f := range o.files {
+		f.Close()
+		delete(o.files, path)
+	}
+}
+
+func (o *OutFile) write(message *FluentMessage) error {
+	line, err := o.formatMessage(message)
+	if err != nil {
+		return err
+	}
+	path := expandOutputTemplate(o.path, message.Tag, message.Timestamp, o.fileTimeFormat)
+	f, err := o.open(path)
+	if err != nil {
+		return err
+	}
+	if o.maxSize > 0 && f.size > 0 && f.size+int64(len(line)) > o.maxSize {
+		if f, err = o.rotate(path); err != nil {
+			return err
+		}
+	}
+	n, err := f.Write(line)
+	f.size += int64(n)
+	f.lastWrite = time.Now()
+	if err != nil {
+		return err
+	}
+
+	if now := time.Now(); now.Sub(o.lastCloseIdle) > outFileIdleTimeout {
+		o.closeIdle(now)
+	}
+	return nil
+}
+
+func (o *OutFile) open(path string) (*outFileHandle, error) {
+	if f, ok := o.files[path]; ok {
+		return f, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	log.Println("[info] out_file: opened", path)
+	f := &outFileHandle{
+		File: file,
+		size: stat.Size(),
+	}
+	o.files[path] = f
+	return f, nil
+}
+
+// rotate renames path to path.1 (path.1 to path.2, ...) and opens new path.
+func (o *OutFile) rotate(path string) (*outFileHandle, error) {
+	if f, ok := o.files[path]; ok {
+		f.Close()
+		delete(o.files, path)
+	}
+	os.Remove(fmt.Sprintf("%s.%d", path, o.maxFiles))
+	for i := o.maxFiles - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", path, i), fmt.Sprintf("%s.%d", path, i+1))
+	}
+	if err := os.Rename(path, path+".1"); err != nil {
+		return nil, err
+	}
+	log.Println("[info] out_file: rotated", path)
+	return o.open(path)
+}
+
+func (o *OutFile) closeIdle(now time.Time) {
+	o.lastCloseIdle = now
+	for path, f := range o.files {
+		if now.Sub(f.lastWrite) > outFileIdleTimeout {
+			f.Close()
+			delete(o.files, path)
+			log.Println("[info] out_file: closed idle file", path)
+		}
+	}
+}
+
+func (o *OutFile) formatMessage(message *FluentMessage) ([]byte, error) {
+	var buf bytes.Buffer
+	switch o.format {
+	case "raw":
+		buf.Write(message.Message)
+	case "ltsv":
+		record := jsonRecord(message)
+		keys := make([]string, 0, len(record))
+		for key := range record {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		fmt.Fprintf(&buf, "time:%s\ttag:%s", message.Timestamp.Format(time.RFC3339Nano), message.Tag)
+		for _, key := range keys {
+			fmt.Fprintf(&buf, "\t%s:%s", key, ltsvEscaper.Replace(fmt.Sprint(record[key])))
+		}
+	default:
+		record := jsonRecord(message)
+		if _, ok := record["time"]; !ok {
+			record["time"] = message.Timestamp.Format(time.RFC3339Nano)
+		}
+		if _, ok := record["tag"]; !ok {
+			record["tag"] = message.Tag
+		}
+		b, err := json.Marshal(record)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(b)
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
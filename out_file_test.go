@@ -0,0 +1,134 @@
+package chimera_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	chimera "github.com/kikumoto/fluent-agent-chimera"
+	pdebug "github.com/lestrrat/go-pdebug"
+	"github.com/stretchr/testify/assert"
+)
+
+func runOutFile(t *testing.T, config *chimera.ConfigOutFile, messages []*chimera.FluentMessage) bool {
+	config.Restrict(&chimera.Config{})
+	out, err := chimera.NewOutFile(config)
+	if !assert.NoError(t, err, "NewOutFile should succeed") {
+		return false
+	}
+	c, ctx := chimera.NewCircumstances()
+	c.RunProcess(ctx, out, false)
+	c.StartProcess.Wait()
+	go func() {
+		for range c.MonitorCh {
+		}
+	}()
+	for _, m := range messages {
+		c.MessageCh <- m
+	}
+	c.Shutdown()
+	return true
+}
+
+func readFile(path string) string {
+	b, _ := ioutil.ReadFile(path)
+	return string(b)
+}
+
+func TestOutFile(t *testing.T) {
+	if pdebug.Enabled {
+		g := pdebug.Marker("TestOutFile")
+		defer g.End()
+	}
+
+	tmpdir, _ := ioutil.TempDir(os.TempDir(), "chimera-test")
+	defer os.RemoveAll(tmpdir)
+
+	day1 := time.Date(2018, 1, 1, 23, 59, 59, 0, time.UTC)
+	day2 := time.Date(2018, 1, 2, 0, 0, 0, 0, time.UTC)
+	message := func(tag string, ts time.Time, msg string) *chimera.FluentMessage {
+		return &chimera.FluentMessage{
+			Tag:           tag,
+			Timestamp:     ts,
+			FieldName:     "message",
+			Message:       []byte(msg),
+			PathFieldName: "path",
+			Path:          "/path/to/file",
+			HostFieldName: "host",
+			Host:          "localhost",
+		}
+	}
+	messages := []*chimera.FluentMessage{
+		message("app.web", day1, "hello\tworld"),
+		message("app.web", day2, "foo"),
+		message("app.batch", day2, "bar"),
+	}
+
+	// json
+	if !runOutFile(t, &chimera.ConfigOutFile{
+		Path: filepath.Join(tmpdir, "json", "${tag}.{date}.log"),
+	}, messages) {
+		return
+	}
+	if !assert.Equal(
+		t,
+		`{"host":"localhost","message":"hello\tworld","path":"/path/to/file","tag":"app.web","time":"2018-01-01T23:59:59Z"}`+"\n",
+		readFile(filepath.Join(tmpdir, "json", "app.web.20180101.log")),
+	) {
+		return
+	}
+	if !assert.Equal(
+		t,
+		`{"host":"localhost","message":"foo","path":"/path/to/file","tag":"app.web","time":"2018-01-02T00:00:00Z"}`+"\n",
+		readFile(filepath.Join(tmpdir, "json", "app.web.20180102.log")),
+	) {
+		return
+	}
+	if !assert.Contains(t, readFile(filepath.Join(tmpdir, "json", "app.batch.20180102.log")), `"message":"bar"`) {
+		return
+	}
+
+	// ltsv
+	if !runOutFile(t, &chimera.ConfigOutFile{
+		Path:   filepath.Join(tmpdir, "ltsv.log"),
+		Format: "ltsv",
+	}, messages[0:1]) {
+		return
+	}
+	if !assert.Equal(
+		t,
+		"time:2018-01-01T23:59:59Z\ttag:app.web\thost:localhost\tmessage:hello\\tworld\tpath:/path/to/file\n",
+		readFile(filepath.Join(tmpdir, "ltsv.log")),
+	) {
+		return
+	}
+
+	// raw with rotation
+	raw := filepath.Join(tmpdir, "raw.log")
+	rotated := []*chimera.FluentMessage{}
+	for _, m := range []string{"1111", "2222", "3333", "4444", "5555"} {
+		rotated = append(rotated, message("app.web", day1, m))
+	}
+	if !runOutFile(t, &chimera.ConfigOutFile{
+		Path:     raw,
+		Format:   "raw",
+		MaxSize:  10,
+		MaxFiles: 2,
+	}, rotated) {
+		return
+	}
+	got := []string{readFile(raw), readFile(raw + ".1"), readFile(raw + ".2")}
+	if !assert.Equal(t, []string{"5555\n", "3333\n4444\n", "1111\n2222\n"}, got) {
+		return
+	}
+	_, err := os.Stat(raw + ".3")
+	if !assert.True(t, os.IsNotExist(err), "rotated files should be limited by MaxFiles") {
+		return
+	}
+
+	_, err = chimera.NewOutFile(&chimera.ConfigOutFile{Path: raw, Format: "csv", MaxFiles: 1})
+	assert.True(t, err != nil && strings.Contains(err.Error(), "csv"), "unknown format should be error")
+}
@@ -31,6 +31,12 @@ import (
 
 type OutForward struct {
 	logger         fluent.Client
+	output         string
+	address        string
+	isDefault      bool
+	fallback       *OutFile
+	maxRetries     int
+	fallingBack    bool
 	messageCh      chan *FluentMessage
 	monitorCh      chan Stat
 	lastPostStatus bool
@@ -43,6 +49,7 @@ const (
 )
 
 // OutForward ... recieve FluentMessage from channel, and send it to passed fluentd until success.
+// If Fallback is configured, the message is written to the fallback file after MaxRetries failures.
 func NewOutForward(s *ConfigServer, subsecond bool) (*OutForward, error) {
 	logger, err := fluent.New(
 		fluent.WithBuffered(false),
@@ -55,9 +62,23 @@ func NewOutForward(s *ConfigServer, subsecond bool) (*OutForward, error) {
 	} else {
 		log.Println("[info] Network:", s.Network, ",Server:", s.Address, "connected")
 	}
-	return &OutForward{
-		logger: logger,
-	}, nil
+	f := &OutForward{
+		logger:     logger,
+		address:    s.Network + ":" + s.Address,
+		isDefault:  true,
+		maxRetries: DefaultMaxRetries,
+	}
+	if s.MaxRetries != nil {
+		f.maxRetries = *s.MaxRetries
+	}
+	if s.Fallback != nil {
+		fallback, err := NewOutFile(s.Fallback)
+		if err != nil {
+			return nil, err
+		}
+		f.fallback = fallback
+	}
+	return f, nil
 }
 
 func (f *OutForward) Run(ctx context.Context, c *Circumstances) {
@@ -66,7 +87,9 @@ func (f *OutForward) Run(ctx context.Context, c *Circumstances) {
 
 	c.OutputProcess.Add(1)
 	defer c.OutputProcess.Done()
-	f.messageCh = c.MessageCh
+	if f.messageCh == nil {
+		f.messageCh = c.MessageCh
+	}
 	f.monitorCh = c.MonitorCh
 
 	c.StartProcess.Done()
@@ -86,6 +109,10 @@ func (f *OutForward) Run(ctx context.Context, c *Circumstances) {
 	}
 }
 
+func (f *OutForward) SetMessageCh(ch chan *FluentMessage) {
+	f.messageCh = ch
+}
+
 func (f *OutForward) outForwardRecieve(ctx context.Context) error {
 	var message *FluentMessage
 	var ok, shutdown bool
@@ -103,28 +130,41 @@ func (f *OutForward) outForwardRecieve(ctx context.Context) error {
 			log.Println("[warn] Failed to shutdown go-fluent-client properly. force-close it")
 			f.logger.Close()
 		}
+		if f.fallback != nil {
+			f.fallback.Close()
+		}
 		return Signal{"shutdown out_forward"}
 	}
 
-	v := map[string]interface{}{
-		message.FieldName:     message.Message,
-		message.PathFieldName: message.Path,
-		message.HostFieldName: message.Host,
-	}
+	v := message.Record()
 
-	for {
+	retryLimit := f.maxRetries
+	if f.fallingBack {
+		// server is still unreachable. don't wait for retries.
+		retryLimit = 0
+	}
+	for retries := 0; ; retries++ {
 		err := f.logger.Post(
 			message.Tag,
 			v,
 			fluent.WithTimestamp(message.Timestamp),
 		)
 		if err != nil {
-			log.Println("[warn] failed to send message. retrying... :", err)
 			f.lastPostStatus = false
 			f.recordError(err)
 			f.logger.Close()
+			if f.fallback != nil && retries >= retryLimit {
+				log.Println("[warn] failed to send message. writing to fallback... :", err)
+				f.fallingBack = true
+				if err := f.fallback.write(message); err != nil {
+					log.Println("[error] failed to write message to fallback.", err)
+				}
+				break
+			}
+			log.Println("[warn] failed to send message. retrying... :", err)
 		} else {
 			f.lastPostStatus = true
+			f.fallingBack = false
 			f.monitorCh <- &SentStat{
 				Tag:   message.Tag,
 				Sents: 1,
@@ -141,8 +181,11 @@ func (f *OutForward) checkServerHealth() {
 	c := time.Tick(serverHealthCheckInterval)
 	for _ = range c {
 		f.monitorCh <- &ServerStat{
-			Alive: f.lastPostStatus,
-			Error: f.lastErrorString(),
+			Output:  f.output,
+			Address: f.address,
+			Default: f.isDefault,
+			Alive:   f.lastPostStatus,
+			Error:   f.lastErrorString(),
 		}
 	}
 }
@@ -0,0 +1,223 @@
+package chimera
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"time"
+)
+
+const (
+	gelfVersion      = "1.1"
+	gelfMaxChunks    = 128
+	gelfChunkHeadLen = 12
+)
+
+var (
+	gelfInvalidKeyChars = regexp.MustCompile(`[^\w\.\-]`)
+)
+
+// OutGELF ... recieve FluentMessage from channel, and send it to Graylog in GELF.
+// Message over UDP is compressed and chunked, and over TCP is delimited by null byte.
+type OutGELF struct {
+	writer      *netWriter
+	name        string
+	network     string
+	compression string
+	chunkSize   int
+	maxRetries  int
+	retryWait   time.Duration
+	messageCh   chan *FluentMessage
+	monitorCh   chan Stat
+}
+
+func NewOutGELF(config *ConfigGELF) (*OutGELF, error) {
+	switch config.Network {
+	case "udp":
+		switch config.Compression {
+		case "gzip", "zlib", "none":
+		default:
+			return nil, fmt.Errorf("unknown gelf compression: %q", config.Compression)
+		}
+		if config.ChunkSize <= gelfChunkHeadLen {
+			return nil, fmt.Errorf("ChunkSize must be greater than %d", gelfChunkHeadLen)
+		}
+	case "tcp":
+		if config.Compression != "none" {
+			return nil, fmt.Errorf("gelf over tcp does not support compression")
+		}
+	default:
+		return nil, fmt.Errorf("unknown gelf network: %q", config.Network)
+	}
+	return &OutGELF{
+		writer:      newNetWriter(config.Network, config.Address, config.Timeout.Duration),
+		name:        "gelf:" + config.Network + ":" + config.Address,
+		network:     config.Network,
+		compression: config.Compression,
+		chunkSize:   config.ChunkSize,
+		maxRetries:  config.MaxRetries,
+		retryWait:   config.RetryWait.Duration,
+	}, nil
+}
+
+func (o *OutGELF) SetMessageCh(ch chan *FluentMessage) {
+	o.messageCh = ch
+}
+
+func (o *OutGELF) Run(ctx context.Context, c *Circumstances) {
+	log.Println("[info] out_gelf: starting")
+	defer log.Println("[info] out_gelf: exiting")
+
+	c.OutputProcess.Add(1)
+	defer c.OutputProcess.Done()
+	if o.messageCh == nil {
+		o.messageCh = c.MessageCh
+	}
+	o.monitorCh = c.MonitorCh
+
+	c.StartProcess.Done()
+
+	for message := range o.messageCh {
+		if err := o.send(message); err != nil {
+			log.Println("[error] out_gelf: failed to send message. dropped.", err)
+			o.monitorCh <- &OutputStat{
+				Output: o.name,
+				Counts: map[string]int64{"failed": 1},
+			}
+			continue
+		}
+		o.monitorCh <- &SentStat{
+			Tag:   message.Tag,
+			Sents: 1,
+		}
+		o.monitorCh <- &OutputStat{
+			Output: o.name,
+			Counts: map[string]int64{"sent": 1},
+		}
+	}
+	log.Println("[info] out_gelf: message channel closed")
+	o.writer.Close()
+}
+
+func (o *OutGELF) send(message *FluentMessage) error {
+	b, err := json.Marshal(gelfMessage(message))
+	if err != nil {
+		return err
+	}
+	var packets [][]byte
+	if o.network == "tcp" {
+		packets = [][]byte{append(b, 0)}
+	} else {
+		if b, err = o.compress(b); err != nil {
+			return err
+		}
+		if packets, err = o.chunk(b); err != nil {
+			return err
+		}
+	}
+
+	wait := o.retryWait
+	for retries := 0; ; retries++ {
+		err = nil
+		for _, p := range packets {
+			if _, err = o.writer.Write(p); err != nil {
+				break
+			}
+		}
+		if err == nil || retries >= o.maxRetries {
+			return err
+		}
+		log.Println("[warn] out_gelf: failed to send message. retrying...", err)
+		time.Sleep(wait)
+		wait *= 2
+	}
+}
+
+// gelfMessage maps the message to GELF payload. Host and message are mapped to host and short_message,
+// and tag and the other fields are added as additional fields prefixed by "_".
+func gelfMessage(message *FluentMessage) map[string]interface{} {
+	record := jsonRecord(message)
+	delete(record, message.FieldName)
+	delete(record, message.HostFieldName)
+
+	v := make(map[string]interface{}, len(record)+5)
+	for key, value := range record {
+		// "_id" is reserved by Graylog, so "id" is sent as "__id"
+		if key == "id" {
+			key = "_id"
+		}
+		switch value.(type) {
+		case string, int, int64, float64:
+		default:
+			value = fmt.Sprint(value)
+		}
+		v["_"+gelfInvalidKeyChars.ReplaceAllString(key, "_")] = value
+	}
+	v["_tag"] = message.Tag
+	v["version"] = gelfVersion
+	v["host"] = message.Host
+	v["short_message"] = string(message.Message)
+	v["timestamp"] = float64(message.Timestamp.UnixNano()/int64(time.Millisecond)) / 1000
+	return v
+}
+
+func (o *OutGELF) compress(b []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	switch o.compression {
+	case "gzip":
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(b); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+	case "zlib":
+		zw := zlib.NewWriter(&buf)
+		if _, err := zw.Write(b); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+	default:
+		return b, nil
+	}
+	return buf.Bytes(), nil
+}
+
+// chunk splits b into GELF chunks when it exceeds chunkSize.
+func (o *OutGELF) chunk(b []byte) ([][]byte, error) {
+	if len(b) <= o.chunkSize {
+		return [][]byte{b}, nil
+	}
+	size := o.chunkSize - gelfChunkHeadLen
+	count := (len(b) + size - 1) / size
+	if count > gelfMaxChunks {
+		return nil, fmt.Errorf("message is too large: %d bytes in %d chunks", len(b), count)
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	chunks := make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		end := (i + 1) * size
+		if end > len(b) {
+			end = len(b)
+		}
+		chunk := make([]byte, 0, gelfChunkHeadLen+end-i*size)
+		chunk = append(chunk, 0x1e, 0x0f)
+		chunk = append(chunk, id...)
+		chunk = append(chunk, byte(i), byte(count))
+		chunk = append(chunk, b[i*size:end]...)
+		chunks = append(chunks, chunk)
+	}
+	return chunks, nil
+}
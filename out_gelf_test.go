@@ -0,0 +1,154 @@
+package chimera_test
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	chimera "github.com/kikumoto/fluent-agent-chimera"
+	pdebug "github.com/lestrrat/go-pdebug"
+	"github.com/stretchr/testify/assert"
+)
+
+func runGELFOutput(t *testing.T, config *chimera.ConfigGELF, message *chimera.FluentMessage) bool {
+	config.Restrict(&chimera.Config{})
+	out, err := chimera.NewOutGELF(config)
+	if !assert.NoError(t, err, "NewOutGELF should succeed") {
+		return false
+	}
+	c, ctx := chimera.NewCircumstances()
+	c.RunProcess(ctx, out, false)
+	c.StartProcess.Wait()
+	go func() {
+		for range c.MonitorCh {
+		}
+	}()
+	c.MessageCh <- message
+	c.Shutdown()
+	return true
+}
+
+func newGELFTestMessage(message string) *chimera.FluentMessage {
+	return &chimera.FluentMessage{
+		Tag:           "app",
+		Timestamp:     time.Unix(1514764800, 123000000),
+		FieldName:     "message",
+		Message:       []byte(message),
+		PathFieldName: "path",
+		Path:          "/path/to/file",
+		HostFieldName: "host",
+		Host:          "localhost",
+		Fields:        map[string]interface{}{"id": "x", "user name": "y"},
+	}
+}
+
+func TestOutGELFUDP(t *testing.T) {
+	if pdebug.Enabled {
+		g := pdebug.Marker("TestOutGELFUDP")
+		defer g.End()
+	}
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+
+	message := strings.Repeat("long message ", 100)
+	if !runGELFOutput(t, &chimera.ConfigGELF{
+		Network:   "udp",
+		Address:   conn.LocalAddr().String(),
+		ChunkSize: 100,
+	}, newGELFTestMessage(message)) {
+		return
+	}
+
+	chunks := map[byte][]byte{}
+	count := 0
+	buf := make([]byte, 65536)
+	for count == 0 || len(chunks) < count {
+		conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if !assert.NoError(t, err, "all chunks should be received") {
+			return
+		}
+		if !assert.Equal(t, []byte{0x1e, 0x0f}, buf[:2], "chunk should have magic bytes") {
+			return
+		}
+		count = int(buf[11])
+		chunks[buf[10]] = append([]byte{}, buf[12:n]...)
+	}
+	var payload []byte
+	for i := 0; i < count; i++ {
+		payload = append(payload, chunks[byte(i)]...)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(payload))
+	if !assert.NoError(t, err, "payload should be gzipped") {
+		return
+	}
+	b, _ := ioutil.ReadAll(zr)
+	var v map[string]interface{}
+	if !assert.NoError(t, json.Unmarshal(b, &v)) {
+		return
+	}
+	assert.Equal(t, map[string]interface{}{
+		"version":       "1.1",
+		"host":          "localhost",
+		"short_message": message,
+		"timestamp":     1514764800.123,
+		"_tag":          "app",
+		"_path":         "/path/to/file",
+		"__id":          "x",
+		"_user_name":    "y",
+	}, v)
+}
+
+func TestOutGELFTCP(t *testing.T) {
+	if pdebug.Enabled {
+		g := pdebug.Marker("TestOutGELFTCP")
+		defer g.End()
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer l.Close()
+	received := make(chan []byte, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		b, _ := bufio.NewReader(conn).ReadBytes(0)
+		received <- b
+	}()
+
+	if !runGELFOutput(t, &chimera.ConfigGELF{
+		Network: "tcp",
+		Address: l.Addr().String(),
+	}, newGELFTestMessage("hello")) {
+		return
+	}
+
+	select {
+	case b := <-received:
+		if !assert.Equal(t, byte(0), b[len(b)-1], "message should be terminated by null byte") {
+			return
+		}
+		var v map[string]interface{}
+		if !assert.NoError(t, json.Unmarshal(b[:len(b)-1], &v)) {
+			return
+		}
+		assert.Equal(t, "hello", v["short_message"])
+	case <-time.After(3 * time.Second):
+		t.Error("message should be received")
+	}
+}
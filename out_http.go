@@ -0,0 +1,269 @@
+package chimera
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	httpMaxResponseSize = 64 * 1024 * 1024
+)
+
+// OutHTTP ... recieve FluentMessage from channel, and POST them in batches to the URL.
+// Records of each batch are grouped by tag when URL contains ${tag}.
+type OutHTTP struct {
+	client        *httpClient
+	format        string
+	timeKey       string
+	tagKey        string
+	batchSize     int
+	flushInterval time.Duration
+	messageCh     chan *FluentMessage
+	monitorCh     chan Stat
+}
+
+func NewOutHTTP(config *ConfigHTTP) (*OutHTTP, error) {
+	switch config.Format {
+	case "json", "msgpack":
+	default:
+		return nil, fmt.Errorf("unknown http format: %q", config.Format)
+	}
+	client, err := newHTTPClient(&config.ConfigHTTPClient)
+	if err != nil {
+		return nil, err
+	}
+	return &OutHTTP{
+		client:        client,
+		format:        config.Format,
+		timeKey:       config.TimeKey,
+		tagKey:        config.TagKey,
+		batchSize:     config.BatchSize,
+		flushInterval: config.FlushInterval.Duration,
+	}, nil
+}
+
+func (o *OutHTTP) SetMessageCh(ch chan *FluentMessage) {
+	o.messageCh = ch
+}
+
+func (o *OutHTTP) Run(ctx context.Context, c *Circumstances) {
+	log.Println("[info] out_http: starting")
+	defer log.Println("[info] out_http: exiting")
+
+	c.OutputProcess.Add(1)
+	defer c.OutputProcess.Done()
+	if o.messageCh == nil {
+		o.messageCh = c.MessageCh
+	}
+	o.monitorCh = c.MonitorCh
+
+	c.StartProcess.Done()
+
+	runBatch(o.messageCh, o.batchSize, o.flushInterval, o.flush)
+	log.Println("[info] out_http: message channel closed")
+}
+
+func (o *OutHTTP) flush(messages []*FluentMessage) {
+	groups := make(map[string][]*FluentMessage)
+	for _, m := range messages {
+		url := expandOutputTemplate(o.client.url, m.Tag, m.Timestamp, "")
+		groups[url] = append(groups[url], m)
+	}
+	urls := make([]string, 0, len(groups))
+	for url := range groups {
+		urls = append(urls, url)
+	}
+	sort.Strings(urls)
+
+	for _, url := range urls {
+		group := groups[url]
+		body, contentType, err := o.encode(group)
+		if err != nil {
+			log.Println("[error] out_http: failed to encode records.", err)
+			continue
+		}
+		if _, err := o.client.post(url, contentType, body); err != nil {
+			log.Println("[error] out_http: failed to post records. dropped", len(group), "records.", err)
+			continue
+		}
+		for _, m := range group {
+			o.monitorCh <- &SentStat{
+				Tag:   m.Tag,
+				Sents: 1,
+			}
+		}
+	}
+}
+
+func (o *OutHTTP) encode(messages []*FluentMessage) ([]byte, string, error) {
+	records := make([]interface{}, len(messages))
+	for i, m := range messages {
+		var record map[string]interface{}
+		if o.format == "json" {
+			record = jsonRecord(m)
+		} else {
+			record = m.Record()
+		}
+		if o.timeKey != "" {
+			record[o.timeKey] = float64(m.Timestamp.UnixNano()) / float64(time.Second)
+		}
+		if o.tagKey != "" {
+			record[o.tagKey] = m.Tag
+		}
+		records[i] = record
+	}
+	if o.format == "msgpack" {
+		b, err := msgpackMarshal(records)
+		return b, "application/msgpack", err
+	}
+	b, err := json.Marshal(records)
+	return b, "application/json", err
+}
+
+// runBatch receives messages from messageCh and calls flush with up to batchSize messages,
+// or with received messages every flushInterval. It returns after messageCh is closed.
+func runBatch(messageCh chan *FluentMessage, batchSize int, flushInterval time.Duration, flush func([]*FluentMessage)) {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*FluentMessage, 0, batchSize)
+	for {
+		select {
+		case message, ok := <-messageCh:
+			if !ok {
+				if len(batch) > 0 {
+					flush(batch)
+				}
+				return
+			}
+			batch = append(batch, message)
+			if len(batch) >= batchSize {
+				flush(batch)
+				batch = make([]*FluentMessage, 0, batchSize)
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				flush(batch)
+				batch = make([]*FluentMessage, 0, batchSize)
+			}
+		}
+	}
+}
+
+// httpClient posts requests with headers, authentication and gzip compression,
+// and retries on network errors and 429/5xx responses.
+type httpClient struct {
+	url         string
+	headers     map[string]string
+	username    string
+	password    string
+	bearerToken string
+	gzip        bool
+	maxRetries  int
+	retryWait   time.Duration
+	client      *http.Client
+}
+
+type httpStatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("unexpected response status %d: %s", e.StatusCode, e.Body)
+}
+
+func newHTTPClient(config *ConfigHTTPClient) (*httpClient, error) {
+	if config.URL == "" {
+		return nil, fmt.Errorf("URL is required")
+	}
+	return &httpClient{
+		url:         config.URL,
+		headers:     config.Headers,
+		username:    config.Username,
+		password:    config.Password,
+		bearerToken: config.BearerToken,
+		gzip:        config.Gzip,
+		maxRetries:  config.MaxRetries,
+		retryWait:   config.RetryWait.Duration,
+		client:      &http.Client{Timeout: config.Timeout.Duration},
+	}, nil
+}
+
+// post sends body to url and returns the response body of 2xx response.
+func (h *httpClient) post(url string, contentType string, body []byte) ([]byte, error) {
+	if h.gzip {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(body); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		body = buf.Bytes()
+	}
+
+	wait := h.retryWait
+	for retries := 0; ; retries++ {
+		resBody, err := h.do(url, contentType, body)
+		if err == nil {
+			return resBody, nil
+		}
+		if e, ok := err.(*httpStatusError); ok && e.StatusCode != http.StatusTooManyRequests && e.StatusCode < 500 {
+			return nil, err
+		}
+		if retries >= h.maxRetries {
+			return nil, err
+		}
+		log.Println("[warn] failed to post to", url, "retrying... :", err)
+		time.Sleep(wait)
+		wait *= 2
+	}
+}
+
+func (h *httpClient) do(url string, contentType string, body []byte) ([]byte, error) {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if h.gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	for key, value := range h.headers {
+		req.Header.Set(key, value)
+	}
+	if h.username != "" {
+		req.SetBasicAuth(h.username, h.password)
+	} else if h.bearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+h.bearerToken)
+	}
+
+	res, err := h.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	resBody, err := ioutil.ReadAll(io.LimitReader(res.Body, httpMaxResponseSize))
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return nil, &httpStatusError{
+			StatusCode: res.StatusCode,
+			Body:       strings.TrimSpace(string(resBody)),
+		}
+	}
+	return resBody, nil
+}
@@ -0,0 +1,188 @@
+package chimera_test
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	chimera "github.com/kikumoto/fluent-agent-chimera"
+	pdebug "github.com/lestrrat/go-pdebug"
+	"github.com/stretchr/testify/assert"
+)
+
+type httpRequest struct {
+	Path    string
+	Header  http.Header
+	Records []map[string]interface{}
+}
+
+type httpTestServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []*httpRequest
+	failures int
+}
+
+// newHTTPTestServer returns a server which responds 503 for the first failures requests.
+func newHTTPTestServer(failures int) *httpTestServer {
+	s := &httpTestServer{failures: failures}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.failures > 0 {
+			s.failures--
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		body := r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			body = zr
+		}
+		var records []map[string]interface{}
+		if err := json.NewDecoder(body).Decode(&records); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.requests = append(s.requests, &httpRequest{
+			Path:    r.URL.Path,
+			Header:  r.Header,
+			Records: records,
+		})
+	}))
+	return s
+}
+
+func TestOutHTTP(t *testing.T) {
+	if pdebug.Enabled {
+		g := pdebug.Marker("TestOutHTTP")
+		defer g.End()
+	}
+
+	s := newHTTPTestServer(2)
+	defer s.Close()
+
+	config := &chimera.ConfigHTTP{
+		ConfigHTTPClient: chimera.ConfigHTTPClient{
+			URL:         s.URL + "/${tag}",
+			Headers:     map[string]string{"X-Test": "chimera"},
+			BearerToken: "secret",
+			Gzip:        true,
+			RetryWait:   chimera.Duration{Duration: 10 * time.Millisecond},
+			BatchSize:   2,
+		},
+		TagKey: "tag",
+	}
+	config.Restrict(&chimera.Config{})
+	out, err := chimera.NewOutHTTP(config)
+	if !assert.NoError(t, err, "NewOutHTTP should succeed") {
+		return
+	}
+
+	c, ctx := chimera.NewCircumstances()
+	c.RunProcess(ctx, out, false)
+	c.StartProcess.Wait()
+	go func() {
+		for range c.MonitorCh {
+		}
+	}()
+
+	ts := time.Unix(1514764800, 500000000)
+	for _, tag := range []string{"app.web", "app.batch", "app.web"} {
+		c.MessageCh <- &chimera.FluentMessage{
+			Tag:           tag,
+			Timestamp:     ts,
+			FieldName:     "message",
+			Message:       []byte("hello " + tag),
+			PathFieldName: "path",
+			Path:          "/path/to/file",
+			HostFieldName: "host",
+			Host:          "localhost",
+		}
+	}
+	c.Shutdown()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !assert.Len(t, s.requests, 3, "a batch should be split by tag and retried on 503") {
+		return
+	}
+	paths := []string{}
+	for _, r := range s.requests {
+		paths = append(paths, r.Path)
+	}
+	if !assert.Equal(t, []string{"/app.batch", "/app.web", "/app.web"}, paths) {
+		return
+	}
+	r := s.requests[0]
+	if !assert.Equal(t, "chimera", r.Header.Get("X-Test")) {
+		return
+	}
+	if !assert.Equal(t, "Bearer secret", r.Header.Get("Authorization")) {
+		return
+	}
+	if !assert.Equal(t, "application/json", r.Header.Get("Content-Type")) {
+		return
+	}
+	assert.Equal(t, []map[string]interface{}{
+		{
+			"message": "hello app.batch",
+			"path":    "/path/to/file",
+			"host":    "localhost",
+			"tag":     "app.batch",
+			"time":    1514764800.5,
+		},
+	}, r.Records)
+}
+
+func TestOutHTTPClientError(t *testing.T) {
+	if pdebug.Enabled {
+		g := pdebug.Marker("TestOutHTTPClientError")
+		defer g.End()
+	}
+
+	var mu sync.Mutex
+	requests := 0
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+		if user, pass, ok := r.BasicAuth(); !ok || user != "user" || pass != "pass" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		http.Error(w, "bad request", http.StatusBadRequest)
+	}))
+	defer s.Close()
+
+	config := &chimera.ConfigHTTP{
+		ConfigHTTPClient: chimera.ConfigHTTPClient{
+			URL:       s.URL,
+			Username:  "user",
+			Password:  "pass",
+			RetryWait: chimera.Duration{Duration: 10 * time.Millisecond},
+		},
+	}
+	config.Restrict(&chimera.Config{})
+	out, err := chimera.NewOutHTTP(config)
+	if !assert.NoError(t, err, "NewOutHTTP should succeed") {
+		return
+	}
+	c, ctx := chimera.NewCircumstances()
+	c.RunProcess(ctx, out, false)
+	c.StartProcess.Wait()
+	c.MessageCh <- &chimera.FluentMessage{Tag: "test", Timestamp: time.Now(), Message: []byte("m")}
+	c.Shutdown()
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 1, requests, "4xx response should not be retried")
+}
@@ -0,0 +1,378 @@
+package chimera
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/snappy"
+)
+
+const (
+	lokiPushPath = "/loki/api/v1/push"
+
+	// lokiStreamIdleTimeout is how long the last timestamp of a stream is kept after the stream gets idle.
+	lokiStreamIdleTimeout = 1 * time.Hour
+)
+
+var (
+	lokiLabelNameRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+// OutLoki ... recieve FluentMessage from channel, and push them to Grafana Loki.
+// Records are grouped into streams by labels, and entries of each stream are sent in time order.
+type OutLoki struct {
+	client        *httpClient
+	pushURL       string
+	name          string
+	labels        map[string]string
+	format        string
+	lineFormat    string
+	maxBatchBytes int
+	batchSize     int
+	flushInterval time.Duration
+	lastTimestamp map[string]*lokiLastTimestamp
+	messageCh     chan *FluentMessage
+	monitorCh     chan Stat
+}
+
+type lokiStream struct {
+	labels  map[string]string
+	key     string
+	entries []*lokiEntry
+}
+
+// lokiLastTimestamp is the last timestamp sent to a stream, and when the stream was sent.
+type lokiLastTimestamp struct {
+	timestamp time.Time
+	sentAt    time.Time
+}
+
+type lokiEntry struct {
+	timestamp time.Time
+	line      string
+	message   *FluentMessage
+}
+
+func NewOutLoki(config *ConfigLoki) (*OutLoki, error) {
+	switch config.Format {
+	case "json":
+	case "protobuf":
+		if config.Gzip {
+			return nil, fmt.Errorf("loki protobuf format is compressed by snappy, Gzip is not available")
+		}
+	default:
+		return nil, fmt.Errorf("unknown loki format: %q", config.Format)
+	}
+	switch config.LineFormat {
+	case "json", "raw":
+	default:
+		return nil, fmt.Errorf("unknown loki line format: %q", config.LineFormat)
+	}
+	for name := range config.Labels {
+		if !lokiLabelNameRegexp.MatchString(name) {
+			return nil, fmt.Errorf("invalid loki label name: %q", name)
+		}
+	}
+	client, err := newHTTPClient(&config.ConfigHTTPClient)
+	if err != nil {
+		return nil, err
+	}
+	return &OutLoki{
+		client:        client,
+		pushURL:       strings.TrimRight(config.URL, "/") + lokiPushPath,
+		name:          "loki:" + config.URL,
+		labels:        config.Labels,
+		format:        config.Format,
+		lineFormat:    config.LineFormat,
+		maxBatchBytes: config.MaxBatchBytes,
+		batchSize:     config.BatchSize,
+		flushInterval: config.FlushInterval.Duration,
+		lastTimestamp: make(map[string]*lokiLastTimestamp),
+	}, nil
+}
+
+func (o *OutLoki) SetMessageCh(ch chan *FluentMessage) {
+	o.messageCh = ch
+}
+
+func (o *OutLoki) Run(ctx context.Context, c *Circumstances) {
+	log.Println("[info] out_loki: starting")
+	defer log.Println("[info] out_loki: exiting")
+
+	c.OutputProcess.Add(1)
+	defer c.OutputProcess.Done()
+	if o.messageCh == nil {
+		o.messageCh = c.MessageCh
+	}
+	o.monitorCh = c.MonitorCh
+
+	c.StartProcess.Done()
+
+	runBatch(o.messageCh, o.batchSize, o.flushInterval, o.flush)
+	log.Println("[info] out_loki: message channel closed")
+}
+
+func (o *OutLoki) flush(messages []*FluentMessage) {
+	streams, dropped := o.streams(messages)
+	if dropped > 0 {
+		log.Println("[warn] out_loki: dropped", dropped, "records which have no label values.")
+		o.monitorCh <- &OutputStat{
+			Output: o.name,
+			Counts: map[string]int64{"failed": int64(dropped)},
+		}
+	}
+
+	// split into push requests of which lines do not exceed maxBatchBytes.
+	var batch []*lokiStream
+	var current *lokiStream
+	size := 0
+	for _, s := range streams {
+		current = nil
+		for _, e := range s.entries {
+			if size > 0 && size+len(e.line) > o.maxBatchBytes {
+				o.push(batch)
+				batch, current, size = nil, nil, 0
+			}
+			if current == nil {
+				current = &lokiStream{labels: s.labels, key: s.key}
+				batch = append(batch, current)
+			}
+			current.entries = append(current.entries, e)
+			size += len(e.line)
+		}
+	}
+	if len(batch) > 0 {
+		o.push(batch)
+	}
+}
+
+// streams groups messages by labels. Entries of each stream are sorted by time,
+// and entries older than the last pushed entry of the stream are sent with the last timestamp
+// because Loki rejects out-of-order entries.
+func (o *OutLoki) streams(messages []*FluentMessage) ([]*lokiStream, int) {
+	streams := make(map[string]*lokiStream)
+	dropped := 0
+	for _, m := range messages {
+		record := jsonRecord(m)
+		labels := o.labelValues(m, record)
+		if len(labels) == 0 {
+			dropped++
+			continue
+		}
+		var line string
+		if o.lineFormat == "raw" {
+			line = string(m.Message)
+		} else {
+			b, err := json.Marshal(record)
+			if err != nil {
+				log.Println("[warn] out_loki: failed to encode record.", err)
+				dropped++
+				continue
+			}
+			line = string(b)
+		}
+		key := lokiLabelsString(labels)
+		s, ok := streams[key]
+		if !ok {
+			s = &lokiStream{labels: labels, key: key}
+			streams[key] = s
+		}
+		s.entries = append(s.entries, &lokiEntry{
+			timestamp: m.Timestamp,
+			line:      line,
+			message:   m,
+		})
+	}
+
+	keys := make([]string, 0, len(streams))
+	for key := range streams {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	now := time.Now()
+	result := make([]*lokiStream, 0, len(keys))
+	for _, key := range keys {
+		s := streams[key]
+		sort.SliceStable(s.entries, func(i, j int) bool {
+			return s.entries[i].timestamp.Before(s.entries[j].timestamp)
+		})
+		last, ok := o.lastTimestamp[key]
+		if !ok {
+			last = &lokiLastTimestamp{}
+			o.lastTimestamp[key] = last
+		}
+		for _, e := range s.entries {
+			if e.timestamp.Before(last.timestamp) {
+				e.timestamp = last.timestamp
+			}
+			last.timestamp = e.timestamp
+		}
+		last.sentAt = now
+		result = append(result, s)
+	}
+	o.expireLastTimestamps(now)
+	return result, dropped
+}
+
+// expireLastTimestamps forgets streams idle for lokiStreamIdleTimeout,
+// so that high-cardinality labels do not grow lastTimestamp forever.
+func (o *OutLoki) expireLastTimestamps(now time.Time) {
+	for key, last := range o.lastTimestamp {
+		if now.Sub(last.sentAt) >= lokiStreamIdleTimeout {
+			delete(o.lastTimestamp, key)
+		}
+	}
+}
+
+// labelValues returns labels of the message. "${tag}" is replaced by tag,
+// and the other sources are looked up from the record. Missing labels are omitted.
+func (o *OutLoki) labelValues(m *FluentMessage, record map[string]interface{}) map[string]string {
+	labels := make(map[string]string, len(o.labels))
+	for name, source := range o.labels {
+		if source == "${tag}" {
+			labels[name] = m.Tag
+			continue
+		}
+		v, ok := record[source]
+		if !ok || v == nil {
+			continue
+		}
+		if s, ok := v.(string); ok {
+			if s != "" {
+				labels[name] = s
+			}
+			continue
+		}
+		labels[name] = fmt.Sprint(v)
+	}
+	return labels
+}
+
+func (o *OutLoki) push(streams []*lokiStream) {
+	n := 0
+	for _, s := range streams {
+		n += len(s.entries)
+	}
+	var body []byte
+	var contentType string
+	var err error
+	if o.format == "protobuf" {
+		body = snappy.Encode(nil, encodeLokiPushRequest(streams))
+		contentType = "application/x-protobuf"
+	} else {
+		body, err = encodeLokiPushJSON(streams)
+		contentType = "application/json"
+	}
+	if err == nil {
+		_, err = o.client.post(o.pushURL, contentType, body)
+	}
+	if err != nil {
+		log.Println("[error] out_loki: failed to push entries. dropped", n, "records.", err)
+		o.monitorCh <- &OutputStat{
+			Output: o.name,
+			Counts: map[string]int64{"failed": int64(n)},
+		}
+		return
+	}
+	for _, s := range streams {
+		for _, e := range s.entries {
+			o.monitorCh <- &SentStat{
+				Tag:   e.message.Tag,
+				Sents: 1,
+			}
+		}
+	}
+	o.monitorCh <- &OutputStat{
+		Output: o.name,
+		Counts: map[string]int64{"pushed": int64(n)},
+	}
+}
+
+// lokiLabelsString returns labels in the form of {name="value", ...} sorted by name.
+func lokiLabelsString(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + "=" + strconv.Quote(labels[name])
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+func encodeLokiPushJSON(streams []*lokiStream) ([]byte, error) {
+	type stream struct {
+		Stream map[string]string `json:"stream"`
+		Values [][2]string       `json:"values"`
+	}
+	req := struct {
+		Streams []stream `json:"streams"`
+	}{
+		Streams: make([]stream, len(streams)),
+	}
+	for i, s := range streams {
+		values := make([][2]string, len(s.entries))
+		for j, e := range s.entries {
+			values[j] = [2]string{strconv.FormatInt(e.timestamp.UnixNano(), 10), e.line}
+		}
+		req.Streams[i] = stream{Stream: s.labels, Values: values}
+	}
+	return json.Marshal(req)
+}
+
+// encodeLokiPushRequest encodes logproto.PushRequest.
+//
+//	PushRequest    { repeated StreamAdapter streams = 1; }
+//	StreamAdapter  { string labels = 1; repeated EntryAdapter entries = 2; }
+//	EntryAdapter   { google.protobuf.Timestamp timestamp = 1; string line = 2; }
+func encodeLokiPushRequest(streams []*lokiStream) []byte {
+	var req []byte
+	for _, s := range streams {
+		var stream []byte
+		stream = appendProtoBytes(stream, 1, []byte(s.key))
+		for _, e := range s.entries {
+			var ts []byte
+			ts = appendProtoVarint(ts, 1, uint64(e.timestamp.Unix()))
+			ts = appendProtoVarint(ts, 2, uint64(e.timestamp.Nanosecond()))
+			var entry []byte
+			entry = appendProtoBytes(entry, 1, ts)
+			entry = appendProtoBytes(entry, 2, []byte(e.line))
+			stream = appendProtoBytes(stream, 2, entry)
+		}
+		req = appendProtoBytes(req, 1, stream)
+	}
+	return req
+}
+
+func appendVarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+// appendProtoVarint appends a varint field. Zero value is omitted as proto3.
+func appendProtoVarint(b []byte, field int, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = appendVarint(b, uint64(field)<<3)
+	return appendVarint(b, v)
+}
+
+// appendProtoBytes appends a length-delimited field.
+func appendProtoBytes(b []byte, field int, v []byte) []byte {
+	b = appendVarint(b, uint64(field)<<3|2)
+	b = appendVarint(b, uint64(len(v)))
+	return append(b, v...)
+}
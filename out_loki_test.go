@@ -0,0 +1,132 @@
+package chimera_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	chimera "github.com/kikumoto/fluent-agent-chimera"
+	pdebug "github.com/lestrrat/go-pdebug"
+	"github.com/stretchr/testify/assert"
+)
+
+type lokiPushRequest struct {
+	Streams []struct {
+		Stream map[string]string `json:"stream"`
+		Values [][2]string       `json:"values"`
+	} `json:"streams"`
+}
+
+func TestOutLoki(t *testing.T) {
+	if pdebug.Enabled {
+		g := pdebug.Marker("TestOutLoki")
+		defer g.End()
+	}
+
+	var mu sync.Mutex
+	var requests []*lokiPushRequest
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.URL.Path != "/loki/api/v1/push" {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		var req lokiPushRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		requests = append(requests, &req)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer s.Close()
+
+	config := &chimera.ConfigLoki{
+		ConfigHTTPClient: chimera.ConfigHTTPClient{
+			URL:       s.URL,
+			BatchSize: 4,
+		},
+		Labels: map[string]string{
+			"job":  "${tag}",
+			"host": "host",
+		},
+		LineFormat:    "raw",
+		MaxBatchBytes: 11,
+	}
+	config.Restrict(&chimera.Config{})
+	out, err := chimera.NewOutLoki(config)
+	if !assert.NoError(t, err, "NewOutLoki should succeed") {
+		return
+	}
+
+	c, ctx := chimera.NewCircumstances()
+	c.RunProcess(ctx, out, false)
+	c.StartProcess.Wait()
+	go func() {
+		for range c.MonitorCh {
+		}
+	}()
+
+	ts := time.Unix(1514764800, 0)
+	for _, m := range []struct {
+		tag     string
+		offset  time.Duration
+		message string
+	}{
+		{"app", 2 * time.Second, "second"},
+		{"web", 0, "web"},
+		{"app", 1 * time.Second, "first"},
+		{"app", 3 * time.Second, "third"},
+	} {
+		c.MessageCh <- &chimera.FluentMessage{
+			Tag:           m.tag,
+			Timestamp:     ts.Add(m.offset),
+			FieldName:     "message",
+			Message:       []byte(m.message),
+			HostFieldName: "host",
+			Host:          "localhost",
+		}
+	}
+	c.Shutdown()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !assert.Len(t, requests, 2, "entries should be split by MaxBatchBytes") {
+		return
+	}
+	r := requests[0]
+	if !assert.Len(t, r.Streams, 1) {
+		return
+	}
+	if !assert.Equal(t, map[string]string{"job": "app", "host": "localhost"}, r.Streams[0].Stream) {
+		return
+	}
+	if !assert.Equal(t, [][2]string{
+		{"1514764801000000000", "first"},
+		{"1514764802000000000", "second"},
+	}, r.Streams[0].Values, "entries should be sorted by time") {
+		return
+	}
+	r = requests[1]
+	if !assert.Len(t, r.Streams, 2) {
+		return
+	}
+	if !assert.Equal(t, [][2]string{{"1514764803000000000", "third"}}, r.Streams[0].Values) {
+		return
+	}
+	assert.Equal(t, map[string]string{"job": "web", "host": "localhost"}, r.Streams[1].Stream)
+}
+
+func TestOutLokiInvalidLabel(t *testing.T) {
+	config := &chimera.ConfigLoki{
+		ConfigHTTPClient: chimera.ConfigHTTPClient{URL: "http://127.0.0.1:3100"},
+		Labels:           map[string]string{"app-name": "app"},
+	}
+	config.Restrict(&chimera.Config{})
+	_, err := chimera.NewOutLoki(config)
+	assert.Error(t, err, "label name including hyphen should be rejected")
+}
@@ -0,0 +1,230 @@
+package chimera
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	otlpLogsPath  = "/v1/logs"
+	otlpScopeName = "fluent-agent-chimera"
+)
+
+// OutOTLP ... recieve FluentMessage from channel, and export them as OTLP log records over HTTP. (JSON encoding)
+// Host is mapped to resource attribute "host.name", and tag, path and fields to log record attributes.
+type OutOTLP struct {
+	client             *httpClient
+	logsURL            string
+	name               string
+	resourceAttributes map[string]string
+	batchSize          int
+	flushInterval      time.Duration
+	messageCh          chan *FluentMessage
+	monitorCh          chan Stat
+}
+
+type otlpKeyValue struct {
+	Key   string        `json:"key"`
+	Value *otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+type otlpLogRecord struct {
+	TimeUnixNano         string          `json:"timeUnixNano"`
+	ObservedTimeUnixNano string          `json:"observedTimeUnixNano"`
+	Body                 *otlpAnyValue   `json:"body"`
+	Attributes           []*otlpKeyValue `json:"attributes,omitempty"`
+}
+
+type otlpScopeLogs struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	LogRecords []*otlpLogRecord `json:"logRecords"`
+}
+
+type otlpResourceLogs struct {
+	Resource struct {
+		Attributes []*otlpKeyValue `json:"attributes"`
+	} `json:"resource"`
+	ScopeLogs []*otlpScopeLogs `json:"scopeLogs"`
+}
+
+type otlpExportRequest struct {
+	ResourceLogs []*otlpResourceLogs `json:"resourceLogs"`
+}
+
+type otlpExportResponse struct {
+	PartialSuccess *struct {
+		RejectedLogRecords json.Number `json:"rejectedLogRecords"`
+		ErrorMessage       string      `json:"errorMessage"`
+	} `json:"partialSuccess"`
+}
+
+func NewOutOTLP(config *ConfigOTLP) (*OutOTLP, error) {
+	client, err := newHTTPClient(&config.ConfigHTTPClient)
+	if err != nil {
+		return nil, err
+	}
+	return &OutOTLP{
+		client:             client,
+		logsURL:            strings.TrimRight(config.URL, "/") + otlpLogsPath,
+		name:               "otlp:" + config.URL,
+		resourceAttributes: config.ResourceAttributes,
+		batchSize:          config.BatchSize,
+		flushInterval:      config.FlushInterval.Duration,
+	}, nil
+}
+
+func (o *OutOTLP) SetMessageCh(ch chan *FluentMessage) {
+	o.messageCh = ch
+}
+
+func (o *OutOTLP) Run(ctx context.Context, c *Circumstances) {
+	log.Println("[info] out_otlp: starting")
+	defer log.Println("[info] out_otlp: exiting")
+
+	c.OutputProcess.Add(1)
+	defer c.OutputProcess.Done()
+	if o.messageCh == nil {
+		o.messageCh = c.MessageCh
+	}
+	o.monitorCh = c.MonitorCh
+
+	c.StartProcess.Done()
+
+	runBatch(o.messageCh, o.batchSize, o.flushInterval, o.flush)
+	log.Println("[info] out_otlp: message channel closed")
+}
+
+func (o *OutOTLP) flush(messages []*FluentMessage) {
+	body, err := json.Marshal(o.exportRequest(messages, time.Now()))
+	if err == nil {
+		body, err = o.client.post(o.logsURL, "application/json", body)
+	}
+	if err != nil {
+		log.Println("[error] out_otlp: failed to export records. dropped", len(messages), "records.", err)
+		o.monitorCh <- &OutputStat{
+			Output: o.name,
+			Counts: map[string]int64{"failed": int64(len(messages))},
+		}
+		return
+	}
+
+	var rejected int64
+	var res otlpExportResponse
+	if err := json.Unmarshal(body, &res); err == nil && res.PartialSuccess != nil {
+		rejected, _ = res.PartialSuccess.RejectedLogRecords.Int64()
+		if rejected > 0 {
+			log.Println("[warn] out_otlp:", rejected, "records were rejected.", res.PartialSuccess.ErrorMessage)
+		}
+	}
+	for _, m := range messages {
+		o.monitorCh <- &SentStat{
+			Tag:   m.Tag,
+			Sents: 1,
+		}
+	}
+	o.monitorCh <- &OutputStat{
+		Output: o.name,
+		Counts: map[string]int64{"exported": int64(len(messages)) - rejected, "failed": rejected},
+	}
+}
+
+// exportRequest builds ExportLogsServiceRequest which has a ResourceLogs per host.
+func (o *OutOTLP) exportRequest(messages []*FluentMessage, now time.Time) *otlpExportRequest {
+	observed := strconv.FormatInt(now.UnixNano(), 10)
+	resources := make(map[string]*otlpResourceLogs)
+	var hosts []string
+	for _, m := range messages {
+		r, ok := resources[m.Host]
+		if !ok {
+			attrs := make(map[string]interface{}, len(o.resourceAttributes)+1)
+			for key, value := range o.resourceAttributes {
+				attrs[key] = value
+			}
+			if m.Host != "" {
+				attrs["host.name"] = m.Host
+			}
+			r = &otlpResourceLogs{
+				ScopeLogs: []*otlpScopeLogs{{}},
+			}
+			r.Resource.Attributes = otlpAttributes(attrs)
+			r.ScopeLogs[0].Scope.Name = otlpScopeName
+			resources[m.Host] = r
+			hosts = append(hosts, m.Host)
+		}
+
+		attrs := make(map[string]interface{}, len(m.Fields)+2)
+		for key, value := range m.Fields {
+			attrs[key] = value
+		}
+		attrs["fluent.tag"] = m.Tag
+		if m.Path != "" {
+			attrs["log.file.path"] = m.Path
+		}
+		r.ScopeLogs[0].LogRecords = append(r.ScopeLogs[0].LogRecords, &otlpLogRecord{
+			TimeUnixNano:         strconv.FormatInt(m.Timestamp.UnixNano(), 10),
+			ObservedTimeUnixNano: observed,
+			Body:                 otlpValue(m.Message),
+			Attributes:           otlpAttributes(attrs),
+		})
+	}
+
+	req := &otlpExportRequest{
+		ResourceLogs: make([]*otlpResourceLogs, 0, len(hosts)),
+	}
+	for _, host := range hosts {
+		req.ResourceLogs = append(req.ResourceLogs, resources[host])
+	}
+	return req
+}
+
+// otlpAttributes converts attrs to KeyValue list sorted by key.
+func otlpAttributes(attrs map[string]interface{}) []*otlpKeyValue {
+	keys := make([]string, 0, len(attrs))
+	for key := range attrs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	kvs := make([]*otlpKeyValue, len(keys))
+	for i, key := range keys {
+		kvs[i] = &otlpKeyValue{Key: key, Value: otlpValue(attrs[key])}
+	}
+	return kvs
+}
+
+func otlpValue(v interface{}) *otlpAnyValue {
+	switch v := v.(type) {
+	case string:
+		return &otlpAnyValue{StringValue: &v}
+	case []byte:
+		s := string(v)
+		return &otlpAnyValue{StringValue: &s}
+	case bool:
+		return &otlpAnyValue{BoolValue: &v}
+	case int:
+		s := strconv.FormatInt(int64(v), 10)
+		return &otlpAnyValue{IntValue: &s}
+	case int64:
+		s := strconv.FormatInt(v, 10)
+		return &otlpAnyValue{IntValue: &s}
+	case float64:
+		return &otlpAnyValue{DoubleValue: &v}
+	default:
+		s := fmt.Sprint(v)
+		return &otlpAnyValue{StringValue: &s}
+	}
+}
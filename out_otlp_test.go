@@ -0,0 +1,107 @@
+package chimera_test
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	chimera "github.com/kikumoto/fluent-agent-chimera"
+	pdebug "github.com/lestrrat/go-pdebug"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutOTLP(t *testing.T) {
+	if pdebug.Enabled {
+		g := pdebug.Marker("TestOutOTLP")
+		defer g.End()
+	}
+
+	var mu sync.Mutex
+	var requests []map[string]interface{}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.URL.Path != "/v1/logs" || r.Header.Get("Content-Encoding") != "gzip" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var req map[string]interface{}
+		if err := json.NewDecoder(zr).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		requests = append(requests, req)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{}`))
+	}))
+	defer s.Close()
+
+	config := &chimera.ConfigOTLP{
+		ConfigHTTPClient: chimera.ConfigHTTPClient{
+			URL:  s.URL,
+			Gzip: true,
+		},
+		ResourceAttributes: map[string]string{"service.name": "chimera"},
+	}
+	config.Restrict(&chimera.Config{})
+	out, err := chimera.NewOutOTLP(config)
+	if !assert.NoError(t, err, "NewOutOTLP should succeed") {
+		return
+	}
+
+	c, ctx := chimera.NewCircumstances()
+	c.RunProcess(ctx, out, false)
+	c.StartProcess.Wait()
+	go func() {
+		for range c.MonitorCh {
+		}
+	}()
+
+	c.MessageCh <- &chimera.FluentMessage{
+		Tag:       "app",
+		Timestamp: time.Unix(1514764800, 500),
+		Message:   []byte("hello"),
+		Path:      "/path/to/file",
+		Host:      "localhost",
+		Fields:    map[string]interface{}{"repeat_count": int64(2)},
+	}
+	c.Shutdown()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !assert.Len(t, requests, 1) {
+		return
+	}
+	resourceLogs := requests[0]["resourceLogs"].([]interface{})
+	if !assert.Len(t, resourceLogs, 1) {
+		return
+	}
+	rl := resourceLogs[0].(map[string]interface{})
+	if !assert.Equal(t, []interface{}{
+		map[string]interface{}{"key": "host.name", "value": map[string]interface{}{"stringValue": "localhost"}},
+		map[string]interface{}{"key": "service.name", "value": map[string]interface{}{"stringValue": "chimera"}},
+	}, rl["resource"].(map[string]interface{})["attributes"]) {
+		return
+	}
+	record := rl["scopeLogs"].([]interface{})[0].(map[string]interface{})["logRecords"].([]interface{})[0].(map[string]interface{})
+	if !assert.Equal(t, "1514764800000000500", record["timeUnixNano"]) {
+		return
+	}
+	if !assert.Equal(t, map[string]interface{}{"stringValue": "hello"}, record["body"]) {
+		return
+	}
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"key": "fluent.tag", "value": map[string]interface{}{"stringValue": "app"}},
+		map[string]interface{}{"key": "log.file.path", "value": map[string]interface{}{"stringValue": "/path/to/file"}},
+		map[string]interface{}{"key": "repeat_count", "value": map[string]interface{}{"intValue": "2"}},
+	}, record["attributes"])
+}
@@ -0,0 +1,85 @@
+package chimera
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+)
+
+const (
+	StdoutTimeFormat = "2006-01-02 15:04:05.000000000 -0700"
+)
+
+// OutStdout ... recieve FluentMessage from channel, and print it to stdout.
+type OutStdout struct {
+	format    string
+	writer    io.Writer
+	messageCh chan *FluentMessage
+	monitorCh chan Stat
+}
+
+func NewOutStdout(config *ConfigStdout) (*OutStdout, error) {
+	switch config.Format {
+	case "json", "msgpack":
+	default:
+		return nil, fmt.Errorf("unknown stdout format: %q", config.Format)
+	}
+	return &OutStdout{
+		format: config.Format,
+		writer: os.Stdout,
+	}, nil
+}
+
+func (o *OutStdout) SetMessageCh(ch chan *FluentMessage) {
+	o.messageCh = ch
+}
+
+func (o *OutStdout) Run(ctx context.Context, c *Circumstances) {
+	log.Println("[info] out_stdout: starting")
+	defer log.Println("[info] out_stdout: exiting")
+
+	c.OutputProcess.Add(1)
+	defer c.OutputProcess.Done()
+	if o.messageCh == nil {
+		o.messageCh = c.MessageCh
+	}
+	o.monitorCh = c.MonitorCh
+
+	c.StartProcess.Done()
+
+	for message := range o.messageCh {
+		if err := o.write(message); err != nil {
+			log.Println("[warn] out_stdout: failed to write message.", err)
+			continue
+		}
+		o.monitorCh <- &SentStat{
+			Tag:   message.Tag,
+			Sents: 1,
+		}
+	}
+	log.Println("[info] out_stdout: message channel closed")
+}
+
+func (o *OutStdout) write(message *FluentMessage) error {
+	var body string
+	switch o.format {
+	case "msgpack":
+		b, err := msgpackMarshal(message.Record())
+		if err != nil {
+			return err
+		}
+		body = hex.EncodeToString(b)
+	default:
+		b, err := json.Marshal(jsonRecord(message))
+		if err != nil {
+			return err
+		}
+		body = string(b)
+	}
+	_, err := fmt.Fprintf(o.writer, "%s %s: %s\n", message.Timestamp.Format(StdoutTimeFormat), message.Tag, body)
+	return err
+}
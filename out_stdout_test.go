@@ -0,0 +1,76 @@
+package chimera
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	pdebug "github.com/lestrrat/go-pdebug"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutStdout(t *testing.T) {
+	if pdebug.Enabled {
+		g := pdebug.Marker("TestOutStdout")
+		defer g.End()
+	}
+
+	ts := time.Date(2018, 1, 2, 3, 4, 5, 6, time.UTC)
+	expected := map[string]string{
+		"json": `2018-01-02 03:04:05.000000006 +0000 test.stdout: {"host":"localhost","message":"hello","path":"/path/to/file","repeat_count":2}` + "\n",
+		// {"host":"localhost","message":bin("hello"),"path":"/path/to/file","repeat_count":2}
+		"msgpack": "2018-01-02 03:04:05.000000006 +0000 test.stdout: " +
+			"84a4686f7374a96c6f63616c686f7374a76d657373616765c40568656c6c6fa470617468ad2f706174682f746f2f66696c65ac7265706561745f636f756e7402\n",
+	}
+	for format, line := range expected {
+		var buf bytes.Buffer
+		out, err := NewOutStdout(&ConfigStdout{Format: format})
+		if !assert.NoError(t, err, "NewOutStdout should succeed") {
+			return
+		}
+		out.writer = &buf
+
+		c, ctx := NewCircumstances()
+		c.RunProcess(ctx, out, false)
+		c.StartProcess.Wait()
+		go func() {
+			for range c.MonitorCh {
+			}
+		}()
+
+		c.MessageCh <- &FluentMessage{
+			Tag:           "test.stdout",
+			Timestamp:     ts,
+			FieldName:     "message",
+			Message:       []byte("hello"),
+			PathFieldName: "path",
+			Path:          "/path/to/file",
+			HostFieldName: "host",
+			Host:          "localhost",
+			Fields:        map[string]interface{}{"repeat_count": int64(2)},
+		}
+		c.Shutdown()
+
+		if !assert.Equal(t, line, buf.String(), "format %s", format) {
+			return
+		}
+	}
+
+	_, err := NewOutStdout(&ConfigStdout{Format: "xml"})
+	if !assert.Error(t, err, "unknown format should be error") {
+		return
+	}
+
+	config := &Config{Server: &ConfigServer{}}
+	config.SetStdoutOutput("msgpack")
+	matches := config.MatchConfigs()
+	assert.True(
+		t,
+		len(matches) == 1 &&
+			matches[0].Type == "stdout" &&
+			matches[0].Stdout.Format == "msgpack" &&
+			strings.Contains(matches[0].Pattern.String(), "**"),
+		"stdout output should replace all outputs",
+	)
+}
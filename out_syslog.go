@@ -0,0 +1,259 @@
+package chimera
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	syslogRFC5424TimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+	syslogRFC3164TimeFormat = time.Stamp
+	syslogMaxAppNameLen     = 48
+	syslogMaxTagLen         = 32
+)
+
+// OutSyslog ... recieve FluentMessage from channel, and send it to syslog server.
+// Facility and severity are taken from fields or tag components, or default values.
+type OutSyslog struct {
+	writer      *netWriter
+	name        string
+	format      string
+	octetCount  bool
+	facility    int
+	severity    int
+	facilityKey string
+	severityKey string
+	tagMapping  bool
+	appName     string
+	maxRetries  int
+	retryWait   time.Duration
+	messageCh   chan *FluentMessage
+	monitorCh   chan Stat
+}
+
+func NewOutSyslog(config *ConfigSyslog) (*OutSyslog, error) {
+	switch config.Format {
+	case "rfc5424", "rfc3164":
+	default:
+		return nil, fmt.Errorf("unknown syslog format: %q", config.Format)
+	}
+	switch config.Framing {
+	case "octet-counting", "non-transparent":
+	default:
+		return nil, fmt.Errorf("unknown syslog framing: %q", config.Framing)
+	}
+	facility, err := parseSyslogFacility(config.Facility)
+	if err != nil {
+		return nil, err
+	}
+	severity, err := parseSyslogSeverity(config.Severity)
+	if err != nil {
+		return nil, err
+	}
+
+	o := &OutSyslog{
+		name:        "syslog:" + config.Network + ":" + config.Address,
+		format:      config.Format,
+		octetCount:  config.Network != "udp" && config.Framing == "octet-counting",
+		facility:    facility,
+		severity:    severity,
+		facilityKey: config.FacilityKey,
+		severityKey: config.SeverityKey,
+		tagMapping:  config.TagMapping,
+		appName:     config.AppName,
+		maxRetries:  config.MaxRetries,
+		retryWait:   config.RetryWait.Duration,
+	}
+	switch config.Network {
+	case "udp", "tcp":
+		o.writer = newNetWriter(config.Network, config.Address, config.Timeout.Duration)
+	case "tls":
+		tlsConfig, err := newSyslogTLSConfig(config)
+		if err != nil {
+			return nil, err
+		}
+		o.writer = newNetWriter("tcp", config.Address, config.Timeout.Duration)
+		o.writer.tlsConfig = tlsConfig
+	default:
+		return nil, fmt.Errorf("unknown syslog network: %q", config.Network)
+	}
+	return o, nil
+}
+
+func newSyslogTLSConfig(config *ConfigSyslog) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         config.ServerName,
+		InsecureSkipVerify: config.InsecureSkipVerify,
+	}
+	if config.CAFile != "" {
+		b, err := ioutil.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("no certificates in %s", config.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if config.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+func (o *OutSyslog) SetMessageCh(ch chan *FluentMessage) {
+	o.messageCh = ch
+}
+
+func (o *OutSyslog) Run(ctx context.Context, c *Circumstances) {
+	log.Println("[info] out_syslog: starting")
+	defer log.Println("[info] out_syslog: exiting")
+
+	c.OutputProcess.Add(1)
+	defer c.OutputProcess.Done()
+	if o.messageCh == nil {
+		o.messageCh = c.MessageCh
+	}
+	o.monitorCh = c.MonitorCh
+
+	c.StartProcess.Done()
+
+	for message := range o.messageCh {
+		if err := o.send(message); err != nil {
+			log.Println("[error] out_syslog: failed to send message. dropped.", err)
+			o.monitorCh <- &OutputStat{
+				Output: o.name,
+				Counts: map[string]int64{"failed": 1},
+			}
+			continue
+		}
+		o.monitorCh <- &SentStat{
+			Tag:   message.Tag,
+			Sents: 1,
+		}
+		o.monitorCh <- &OutputStat{
+			Output: o.name,
+			Counts: map[string]int64{"sent": 1},
+		}
+	}
+	log.Println("[info] out_syslog: message channel closed")
+	o.writer.Close()
+}
+
+func (o *OutSyslog) send(message *FluentMessage) error {
+	b := o.formatMessage(message)
+	if o.octetCount {
+		b = append([]byte(strconv.Itoa(len(b))+" "), b...)
+	} else if o.writer.network != "udp" {
+		b = append(b, '\n')
+	}
+
+	wait := o.retryWait
+	for retries := 0; ; retries++ {
+		_, err := o.writer.Write(b)
+		if err == nil || retries >= o.maxRetries {
+			return err
+		}
+		log.Println("[warn] out_syslog: failed to send message. retrying...", err)
+		time.Sleep(wait)
+		wait *= 2
+	}
+}
+
+// priority returns PRI of the message. Fields specified by FacilityKey and SeverityKey take precedence,
+// and then components of tag (e.g. "syslog.auth.warn") are used when TagMapping is enabled.
+// The last matched components are used, as the facility precedes the severity at the end of the tag.
+func (o *OutSyslog) priority(message *FluentMessage) int {
+	facility, severity := o.facility, o.severity
+	facilityFound, severityFound := false, false
+	if o.facilityKey != "" {
+		if v, ok := message.Fields[o.facilityKey]; ok {
+			if f, err := parseSyslogFacility(fmt.Sprint(v)); err == nil {
+				facility, facilityFound = f, true
+			}
+		}
+	}
+	if o.severityKey != "" {
+		if v, ok := message.Fields[o.severityKey]; ok {
+			if s, err := parseSyslogSeverity(fmt.Sprint(v)); err == nil {
+				severity, severityFound = s, true
+			}
+		}
+	}
+	if o.tagMapping {
+		components := strings.Split(message.Tag, ".")
+		for i := len(components) - 1; i >= 0; i-- {
+			component := components[i]
+			if !facilityFound {
+				if f, err := parseSyslogFacility(component); err == nil {
+					facility, facilityFound = f, true
+					continue
+				}
+			}
+			if !severityFound {
+				if s, err := parseSyslogSeverity(component); err == nil {
+					severity, severityFound = s, true
+				}
+			}
+		}
+	}
+	return facility*8 + severity
+}
+
+func (o *OutSyslog) formatMessage(message *FluentMessage) []byte {
+	var buf bytes.Buffer
+	appName := syslogPrintable(expandOutputTemplate(o.appName, message.Tag, message.Timestamp, ""))
+	host := syslogPrintable(message.Host)
+	if o.format == "rfc3164" {
+		if len(appName) > syslogMaxTagLen {
+			appName = appName[:syslogMaxTagLen]
+		}
+		fmt.Fprintf(&buf, "<%d>%s %s %s: ",
+			o.priority(message),
+			message.Timestamp.Format(syslogRFC3164TimeFormat),
+			host,
+			appName,
+		)
+	} else {
+		if len(appName) > syslogMaxAppNameLen {
+			appName = appName[:syslogMaxAppNameLen]
+		}
+		if host == "" {
+			host = "-"
+		}
+		if appName == "" {
+			appName = "-"
+		}
+		fmt.Fprintf(&buf, "<%d>1 %s %s %s - - - ",
+			o.priority(message),
+			message.Timestamp.Format(syslogRFC5424TimeFormat),
+			host,
+			appName,
+		)
+	}
+	buf.Write(bytes.TrimRight(message.Message, "\n"))
+	return buf.Bytes()
+}
+
+// syslogPrintable replaces characters which are not allowed in HOSTNAME and APP-NAME by "_".
+func syslogPrintable(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 {
+			return '_'
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,147 @@
+package chimera_test
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	chimera "github.com/kikumoto/fluent-agent-chimera"
+	pdebug "github.com/lestrrat/go-pdebug"
+	"github.com/stretchr/testify/assert"
+)
+
+func runSyslogOutput(t *testing.T, config *chimera.ConfigSyslog, messages ...*chimera.FluentMessage) bool {
+	config.Restrict(&chimera.Config{})
+	out, err := chimera.NewOutSyslog(config)
+	if !assert.NoError(t, err, "NewOutSyslog should succeed") {
+		return false
+	}
+	c, ctx := chimera.NewCircumstances()
+	c.RunProcess(ctx, out, false)
+	c.StartProcess.Wait()
+	go func() {
+		for range c.MonitorCh {
+		}
+	}()
+	for _, m := range messages {
+		c.MessageCh <- m
+	}
+	c.Shutdown()
+	return true
+}
+
+func TestOutSyslogTCP(t *testing.T) {
+	if pdebug.Enabled {
+		g := pdebug.Marker("TestOutSyslogTCP")
+		defer g.End()
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer l.Close()
+	received := make(chan string, 2)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for {
+			var n int
+			if _, err := fmt.Fscanf(r, "%d ", &n); err != nil {
+				return
+			}
+			b := make([]byte, n)
+			if _, err := io.ReadFull(r, b); err != nil {
+				return
+			}
+			received <- string(b)
+		}
+	}()
+
+	ts := time.Date(2018, 1, 2, 3, 4, 5, 123456789, time.UTC)
+	if !runSyslogOutput(t, &chimera.ConfigSyslog{
+		Network:     "tcp",
+		Address:     l.Addr().String(),
+		SeverityKey: "level",
+		TagMapping:  true,
+	},
+		&chimera.FluentMessage{
+			Tag:       "secure.authpriv",
+			Timestamp: ts,
+			Message:   []byte("login failed\n"),
+			Host:      "web01",
+			Fields:    map[string]interface{}{"level": "warn"},
+		},
+		&chimera.FluentMessage{
+			Tag:       "app.err",
+			Timestamp: ts,
+			Message:   []byte("error"),
+		},
+		// "syslog" of TagPrefix of in_syslog is also a facility
+		&chimera.FluentMessage{
+			Tag:       "syslog.auth.warn",
+			Timestamp: ts,
+			Message:   []byte("forwarded"),
+		},
+	) {
+		return
+	}
+
+	for _, expected := range []string{
+		"<84>1 2018-01-02T03:04:05.123456Z web01 secure.authpriv - - - login failed",
+		"<11>1 2018-01-02T03:04:05.123456Z - app.err - - - error",
+		"<36>1 2018-01-02T03:04:05.123456Z - syslog.auth.warn - - - forwarded",
+	} {
+		select {
+		case m := <-received:
+			if !assert.Equal(t, expected, m) {
+				return
+			}
+		case <-time.After(3 * time.Second):
+			t.Error("message should be received")
+			return
+		}
+	}
+}
+
+func TestOutSyslogUDP(t *testing.T) {
+	if pdebug.Enabled {
+		g := pdebug.Marker("TestOutSyslogUDP")
+		defer g.End()
+	}
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+
+	if !runSyslogOutput(t, &chimera.ConfigSyslog{
+		Address:  conn.LocalAddr().String(),
+		Format:   "rfc3164",
+		Facility: "local0",
+		AppName:  "chimera",
+	}, &chimera.FluentMessage{
+		Tag:       "app",
+		Timestamp: time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC),
+		Message:   []byte("hello"),
+		Host:      "web01",
+	}) {
+		return
+	}
+
+	buf := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if !assert.NoError(t, err, "message should be received") {
+		return
+	}
+	assert.Equal(t, "<134>Jan  2 03:04:05 web01 chimera: hello", string(buf[:n]))
+}
@@ -0,0 +1,76 @@
+package chimera
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Output is a Process which consumes FluentMessages delivered by Pipeline.
+type Output interface {
+	Process
+	SetMessageCh(chan *FluentMessage)
+}
+
+// NewOutput creates an Output from [[Match]] section.
+func NewOutput(cm *ConfigMatch, config *Config) (Output, error) {
+	switch cm.Type {
+	case "forward":
+		f, err := NewOutForward(cm.Server, config.SubSecondTime)
+		if err != nil {
+			return nil, err
+		}
+		f.output = cm.Pattern.String()
+		f.isDefault = cm.Server == config.Server
+		return f, nil
+	case "stdout":
+		return NewOutStdout(cm.Stdout)
+	case "file":
+		return NewOutFile(cm.File)
+	case "http":
+		return NewOutHTTP(cm.HTTP)
+	case "elasticsearch":
+		return NewOutElasticsearch(cm.Elasticsearch)
+	case "loki":
+		return NewOutLoki(cm.Loki)
+	case "otlp":
+		return NewOutOTLP(cm.OTLP)
+	case "gelf":
+		return NewOutGELF(cm.GELF)
+	case "syslog":
+		return NewOutSyslog(cm.Syslog)
+	default:
+		return nil, fmt.Errorf("unknown output type: %q", cm.Type)
+	}
+}
+
+// jsonRecord returns the record of the message whose []byte values are converted to string.
+func jsonRecord(message *FluentMessage) map[string]interface{} {
+	v := message.Record()
+	for key, value := range v {
+		if b, ok := value.([]byte); ok {
+			v[key] = string(b)
+		}
+	}
+	return v
+}
+
+// monitorURL returns rawurl without the user info, not to show credentials on the monitor.
+func monitorURL(rawurl string) string {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return ""
+	}
+	u.User = nil
+	return u.String()
+}
+
+// expandOutputTemplate replaces ${tag} with tag and {date} with t formatted by timeFormat.
+func expandOutputTemplate(template string, tag string, t time.Time, timeFormat string) string {
+	s := strings.Replace(template, "${tag}", tag, -1)
+	if timeFormat != "" {
+		s = strings.Replace(s, "{date}", t.Format(timeFormat), -1)
+	}
+	return s
+}
@@ -0,0 +1,229 @@
+package chimera
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// Parser parses the raw line in Message into Message, Fields and Timestamp.
+type Parser interface {
+	Parse(message *FluentMessage) error
+}
+
+const (
+	// maxPartialLineSize is the max size of a line reassembled from partial lines.
+	maxPartialLineSize = 1024 * 1024
+)
+
+// errPartialLine is returned by Parse when the line is a part of a longer line.
+// The message must not be sent, and the whole line is parsed with the last part.
+var errPartialLine = errors.New("partial line")
+
+// NewParser creates a Parser of config.Format. "raw" returns nil, which leaves lines as they are.
+// Parsers of "docker" and "cri" keep partial lines, so a parser must be created for each source.
+func NewParser(config *ConfigParser) (Parser, error) {
+	switch config.Format {
+	case "", "raw":
+		return nil, nil
+	case "json":
+		return &recordParser{config: config, decode: decodeJSONRecord}, nil
+	case "ltsv":
+		return &recordParser{config: config, decode: decodeLTSVRecord}, nil
+	case "docker":
+		return newContainerParser(decodeDockerLine), nil
+	case "cri":
+		return newContainerParser(decodeCRILine), nil
+	default:
+		return nil, fmt.Errorf("unknown format: %q", config.Format)
+	}
+}
+
+// recordParser parses a line into a record. The value of FieldName in the record is used as Message,
+// the value of TimeKey as Timestamp, and the others as Fields.
+type recordParser struct {
+	config *ConfigParser
+	decode func([]byte) (map[string]interface{}, error)
+}
+
+func (p *recordParser) Parse(message *FluentMessage) error {
+	record, err := p.decode(message.Message)
+	if err != nil {
+		return err
+	}
+	if p.config.TimeKey != "" {
+		if v, ok := record[p.config.TimeKey]; ok {
+			t, err := parseTimeValue(v, p.config.TimeFormat)
+			if err != nil {
+				return err
+			}
+			message.Timestamp = t
+			delete(record, p.config.TimeKey)
+		}
+	}
+	if s, ok := record[message.FieldName].(string); ok {
+		message.Message = []byte(s)
+		delete(record, message.FieldName)
+	} else {
+		// the record has no message
+		message.FieldName = ""
+		message.Message = nil
+	}
+	if message.Fields == nil {
+		message.Fields = make(map[string]interface{}, len(record))
+	}
+	for key, value := range record {
+		message.Fields[key] = value
+	}
+	return nil
+}
+
+func decodeJSONRecord(b []byte) (map[string]interface{}, error) {
+	var record map[string]interface{}
+	if err := json.Unmarshal(b, &record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// decodeLTSVRecord decodes "label:value<TAB>label:value..." into a record.
+func decodeLTSVRecord(b []byte) (map[string]interface{}, error) {
+	record := make(map[string]interface{})
+	for _, field := range bytes.Split(bytes.TrimRight(b, "\r"), []byte{'\t'}) {
+		if len(field) == 0 {
+			continue
+		}
+		i := bytes.IndexByte(field, ':')
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid LTSV field: %q", field)
+		}
+		record[string(field[:i])] = string(field[i+1:])
+	}
+	return record, nil
+}
+
+// parseTimeValue parses v by layout of time.Format, or as unix time when layout is "unix".
+func parseTimeValue(v interface{}, layout string) (time.Time, error) {
+	switch v := v.(type) {
+	case float64:
+		sec, frac := math.Modf(v)
+		return time.Unix(int64(sec), int64(frac*float64(time.Second))), nil
+	case string:
+		if layout == "unix" {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return time.Time{}, err
+			}
+			return parseTimeValue(f, layout)
+		}
+		return time.Parse(layout, v)
+	}
+	return time.Time{}, fmt.Errorf("invalid time value: %v", v)
+}
+
+// containerLine is a line of container logs.
+type containerLine struct {
+	log     []byte
+	stream  string
+	time    time.Time
+	partial bool
+}
+
+// containerParser unwraps container logs written by docker json-file driver or CRI runtimes.
+// The log is used as Message, the stream as "stream" field, and the time as Timestamp.
+// Partial lines are reassembled for each stream.
+type containerParser struct {
+	decode   func([]byte) (*containerLine, error)
+	partials map[string]*containerLine
+}
+
+func newContainerParser(decode func([]byte) (*containerLine, error)) *containerParser {
+	return &containerParser{
+		decode:   decode,
+		partials: make(map[string]*containerLine),
+	}
+}
+
+func (p *containerParser) Parse(message *FluentMessage) error {
+	line, err := p.decode(message.Message)
+	if err != nil {
+		return err
+	}
+	if buffered, ok := p.partials[line.stream]; ok {
+		buffered.log = append(buffered.log, line.log...)
+		buffered.partial = line.partial
+		line = buffered
+	}
+	if line.partial && len(line.log) < maxPartialLineSize {
+		p.partials[line.stream] = line
+		return errPartialLine
+	}
+	delete(p.partials, line.stream)
+
+	message.Message = line.log
+	message.Timestamp = line.time
+	if message.Fields == nil {
+		message.Fields = make(map[string]interface{}, 1)
+	}
+	message.Fields["stream"] = line.stream
+	return nil
+}
+
+// decodeDockerLine decodes {"log":"...\n","stream":"stdout","time":"..."}.
+// The log not terminated by newline is a part of a long line.
+func decodeDockerLine(b []byte) (*containerLine, error) {
+	var record struct {
+		Log    string `json:"log"`
+		Stream string `json:"stream"`
+		Time   string `json:"time"`
+	}
+	if err := json.Unmarshal(b, &record); err != nil {
+		return nil, err
+	}
+	t, err := time.Parse(time.RFC3339Nano, record.Time)
+	if err != nil {
+		return nil, err
+	}
+	line := &containerLine{
+		log:    []byte(record.Log),
+		stream: record.Stream,
+		time:   t,
+	}
+	if bytes.HasSuffix(line.log, LineSeparator) {
+		line.log = bytes.TrimRight(line.log, "\r\n")
+	} else {
+		line.partial = true
+	}
+	return line, nil
+}
+
+// decodeCRILine decodes "<time> <stream> <P|F>[:flags] <log>".
+func decodeCRILine(b []byte) (*containerLine, error) {
+	parts := bytes.SplitN(b, []byte{' '}, 4)
+	if len(parts) < 3 {
+		return nil, fmt.Errorf("invalid CRI log: %q", b)
+	}
+	t, err := time.Parse(time.RFC3339Nano, string(parts[0]))
+	if err != nil {
+		return nil, err
+	}
+	line := &containerLine{
+		stream: string(parts[1]),
+		time:   t,
+	}
+	switch tag := parts[2]; {
+	case bytes.HasPrefix(tag, []byte("P")):
+		line.partial = true
+	case bytes.HasPrefix(tag, []byte("F")):
+	default:
+		return nil, fmt.Errorf("invalid CRI log tag: %q", tag)
+	}
+	if len(parts) == 4 {
+		line.log = append([]byte{}, parts[3]...)
+	}
+	return line, nil
+}
@@ -0,0 +1,156 @@
+package chimera_test
+
+import (
+	"testing"
+	"time"
+
+	chimera "github.com/kikumoto/fluent-agent-chimera"
+	pdebug "github.com/lestrrat/go-pdebug"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParser(t *testing.T) {
+	if pdebug.Enabled {
+		g := pdebug.Marker("TestParser")
+		defer g.End()
+	}
+
+	now := time.Now()
+	tests := []struct {
+		config    chimera.ConfigParser
+		line      string
+		fieldName string
+		message   string
+		fields    map[string]interface{}
+		timestamp time.Time
+		err       bool
+	}{
+		{
+			config:    chimera.ConfigParser{Format: "json", TimeKey: "time", TimeFormat: time.RFC3339},
+			line:      `{"message":"hello","time":"2018-01-02T03:04:05.5Z","status":200}`,
+			fieldName: "message",
+			message:   "hello",
+			fields:    map[string]interface{}{"status": float64(200)},
+			timestamp: time.Date(2018, 1, 2, 3, 4, 5, 500000000, time.UTC),
+		},
+		{
+			config:    chimera.ConfigParser{Format: "ltsv", TimeKey: "time", TimeFormat: "unix"},
+			line:      "time:1514764800\thost:example.com\tstatus:200",
+			fieldName: "",
+			fields:    map[string]interface{}{"host": "example.com", "status": "200"},
+			timestamp: time.Unix(1514764800, 0),
+		},
+		{
+			config:    chimera.ConfigParser{Format: "json"},
+			line:      `not json`,
+			fieldName: "message",
+			message:   "not json",
+			timestamp: now,
+			err:       true,
+		},
+	}
+	for _, test := range tests {
+		parser, err := chimera.NewParser(&test.config)
+		if !assert.NoError(t, err, "NewParser should succeed") {
+			return
+		}
+		m := &chimera.FluentMessage{
+			Timestamp: now,
+			FieldName: "message",
+			Message:   []byte(test.line),
+		}
+		err = parser.Parse(m)
+		if test.err {
+			if !assert.Error(t, err, test.line) {
+				return
+			}
+		} else if !assert.NoError(t, err, test.line) {
+			return
+		}
+		if !assert.Equal(t, test.fieldName, m.FieldName, test.line) {
+			return
+		}
+		if !assert.Equal(t, test.message, string(m.Message), test.line) {
+			return
+		}
+		if !assert.Equal(t, test.fields, m.Fields, test.line) {
+			return
+		}
+		if !assert.True(t, test.timestamp.Equal(m.Timestamp), test.line) {
+			return
+		}
+	}
+
+	_, err := chimera.NewParser(&chimera.ConfigParser{Format: "xml"})
+	assert.Error(t, err, "unknown format should be rejected")
+}
+
+func TestContainerParser(t *testing.T) {
+	if pdebug.Enabled {
+		g := pdebug.Marker("TestContainerParser")
+		defer g.End()
+	}
+
+	tests := []struct {
+		format string
+		lines  []string
+	}{
+		{
+			format: "docker",
+			lines: []string{
+				`{"log":"first ","stream":"stdout","time":"2018-01-02T03:04:05.123456789Z"}`,
+				`{"log":"error\n","stream":"stderr","time":"2018-01-02T03:04:06Z"}`,
+				`{"log":"line\n","stream":"stdout","time":"2018-01-02T03:04:07Z"}`,
+			},
+		},
+		{
+			format: "cri",
+			lines: []string{
+				"2018-01-02T03:04:05.123456789Z stdout P first ",
+				"2018-01-02T03:04:06Z stderr F error",
+				"2018-01-02T03:04:07Z stdout F line",
+			},
+		},
+	}
+	for _, test := range tests {
+		parser, err := chimera.NewParser(&chimera.ConfigParser{Format: test.format})
+		if !assert.NoError(t, err, "NewParser should succeed") {
+			return
+		}
+		var messages []*chimera.FluentMessage
+		for _, line := range test.lines {
+			m := &chimera.FluentMessage{
+				Timestamp: time.Now(),
+				FieldName: "message",
+				Message:   []byte(line),
+			}
+			if parser.Parse(m) == nil {
+				messages = append(messages, m)
+			}
+		}
+		if !assert.Len(t, messages, 2, test.format) {
+			return
+		}
+		if !assert.Equal(t, "error", string(messages[0].Message), test.format) {
+			return
+		}
+		if !assert.Equal(t, "stderr", messages[0].Fields["stream"], test.format) {
+			return
+		}
+		if !assert.Equal(t, "first line", string(messages[1].Message), test.format) {
+			return
+		}
+		if !assert.Equal(t, "stdout", messages[1].Fields["stream"], test.format) {
+			return
+		}
+		// the time of the first part
+		if !assert.True(t, time.Date(2018, 1, 2, 3, 4, 5, 123456789, time.UTC).Equal(messages[1].Timestamp), test.format) {
+			return
+		}
+
+		m := &chimera.FluentMessage{Message: []byte("broken")}
+		if !assert.Error(t, parser.Parse(m), test.format) {
+			return
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package chimera
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+)
+
+// TagPattern is a fluentd style tag pattern.
+// "*" matches a single tag part, "**" matches zero or more tag parts and
+// "{X,Y}" matches X or Y. Multiple patterns can be given separated by whitespace.
+type TagPattern struct {
+	patterns []*regexp.Regexp
+	source   string
+}
+
+// CompileTagPattern parses a fluentd style tag pattern.
+func CompileTagPattern(s string) (*TagPattern, error) {
+	p := &TagPattern{source: s}
+	for _, f := range strings.Fields(s) {
+		re, err := regexp.Compile(`\A` + tagPatternToRegexp(f) + `\z`)
+		if err != nil {
+			return nil, err
+		}
+		p.patterns = append(p.patterns, re)
+	}
+	return p, nil
+}
+
+// MustCompileTagPattern is like CompileTagPattern but panics if the pattern cannot be parsed.
+func MustCompileTagPattern(s string) *TagPattern {
+	p, err := CompileTagPattern(s)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// Match reports whether the tag matches any of the patterns.
+func (p *TagPattern) Match(tag string) bool {
+	for _, re := range p.patterns {
+		if re.MatchString(tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// QuoteTagPattern returns a pattern which matches the tag literally.
+func QuoteTagPattern(tag string) string {
+	var buf bytes.Buffer
+	for _, c := range []byte(tag) {
+		switch c {
+		case '*', '{', '}', ',', '\\':
+			buf.WriteByte('\\')
+		}
+		buf.WriteByte(c)
+	}
+	return buf.String()
+}
+
+func (p *TagPattern) String() string {
+	return p.source
+}
+
+func (p *TagPattern) UnmarshalText(text []byte) error {
+	compiled, err := CompileTagPattern(string(text))
+	if err != nil {
+		return err
+	}
+	*p = *compiled
+	return nil
+}
+
+// tagPatternToRegexp converts a pattern to regexp in the same way as fluentd's GlobMatchPattern.
+func tagPatternToRegexp(pat string) string {
+	stack := [][]string{}
+	regex := []string{""}
+	dot := false
+	for i := 0; i < len(pat); {
+		c := pat[i]
+		last := len(regex) - 1
+		switch {
+		case c == '\\' && i+1 < len(pat):
+			regex[last] += regexp.QuoteMeta(pat[i+1 : i+2])
+			i += 2
+			continue
+		case strings.HasPrefix(pat[i:], "**"):
+			followedByDot := i+2 < len(pat) && pat[i+2] == '.'
+			switch {
+			case dot && followedByDot:
+				// "a.**.b" matches "a.b" and "a.x.y.b"
+				regex[last] += `\.(?:.*\.)?`
+			case dot:
+				// "a.**" matches "a" and "a.x.y"
+				regex[last] += `(?:\..*)?`
+			case followedByDot:
+				// "**.b" matches "b" and "x.y.b"
+				regex[last] += `(?:.*\.)?`
+			default:
+				regex[last] += `.*`
+			}
+			dot = false
+			if followedByDot {
+				i += 3
+			} else {
+				i += 2
+			}
+			continue
+		case dot:
+			regex[last] += `\.`
+			dot = false
+		}
+
+		switch {
+		case c == '.':
+			dot = true
+		case c == '*':
+			regex[last] += `[^.]*`
+		case c == '{':
+			stack = append(stack, []string{})
+			regex = append(regex, "")
+		case c == '}' && len(stack) > 0:
+			alts := append(stack[len(stack)-1], regex[last])
+			stack = stack[:len(stack)-1]
+			regex = regex[:last]
+			regex[len(regex)-1] += "(?:" + strings.Join(alts, "|") + ")"
+		case c == ',' && len(stack) > 0:
+			stack[len(stack)-1] = append(stack[len(stack)-1], regex[last])
+			regex[last] = ""
+		default:
+			regex[last] += regexp.QuoteMeta(string(c))
+		}
+		i++
+	}
+	if dot {
+		regex[len(regex)-1] += `\.`
+	}
+	// unclosed braces
+	for len(stack) > 0 {
+		last := len(regex) - 1
+		alts := append(stack[len(stack)-1], regex[last])
+		stack = stack[:len(stack)-1]
+		regex = regex[:last]
+		regex[len(regex)-1] += "(?:" + strings.Join(alts, "|") + ")"
+	}
+	return regex[0]
+}
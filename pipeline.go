@@ -0,0 +1,99 @@
+package chimera
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+const (
+	filterFlushInterval = 500 * time.Millisecond
+)
+
+// Pipeline receives FluentMessages from inputs, applies filters and routes them to outputs.
+type Pipeline struct {
+	filters   *FilterChain
+	routes    []*route
+	messageCh chan *FluentMessage
+}
+
+type route struct {
+	pattern *TagPattern
+	copy    bool
+	ch      chan *FluentMessage
+}
+
+func NewPipeline(filters *FilterChain) *Pipeline {
+	if filters == nil {
+		filters = &FilterChain{}
+	}
+	return &Pipeline{
+		filters: filters,
+	}
+}
+
+// AddOutput connects output to the pipeline to receive all messages.
+// It must be called before the output runs.
+func (p *Pipeline) AddOutput(output Output) {
+	p.AddRoute(MustCompileTagPattern(DefaultTagPattern), true, output)
+}
+
+// AddRoute connects output to the pipeline to receive messages whose tag matches pattern.
+// Routes are evaluated in order of addition, and a message is passed to the first matched output.
+// If copy is true, the message is also passed to following matched outputs.
+// It must be called before the output runs.
+func (p *Pipeline) AddRoute(pattern *TagPattern, copy bool, output Output) {
+	ch := make(chan *FluentMessage, MessageChannelBufferLen)
+	output.SetMessageCh(ch)
+	p.routes = append(p.routes, &route{
+		pattern: pattern,
+		copy:    copy,
+		ch:      ch,
+	})
+}
+
+func (p *Pipeline) Run(ctx context.Context, c *Circumstances) {
+	c.OutputProcess.Add(1)
+	defer c.OutputProcess.Done()
+	p.messageCh = c.MessageCh
+
+	c.StartProcess.Done()
+
+	ticker := time.NewTicker(filterFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case message, ok := <-p.messageCh:
+			if !ok {
+				log.Println("[info] pipeline: message channel closed")
+				p.emit(p.filters.Flush(time.Now(), true))
+				for _, r := range p.routes {
+					close(r.ch)
+				}
+				return
+			}
+			p.emit(p.filters.Apply(message))
+		case now := <-ticker.C:
+			p.emit(p.filters.Flush(now, false))
+		}
+	}
+}
+
+func (p *Pipeline) emit(messages []*FluentMessage) {
+	for _, m := range messages {
+		matched := false
+		for _, r := range p.routes {
+			if !r.pattern.Match(m.Tag) {
+				continue
+			}
+			r.ch <- m
+			matched = true
+			if !r.copy {
+				break
+			}
+		}
+		if !matched {
+			log.Println("[debug] pipeline: no output matched. tag:", m.Tag)
+		}
+	}
+}
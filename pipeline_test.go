@@ -0,0 +1,116 @@
+package chimera_test
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	chimera "github.com/kikumoto/fluent-agent-chimera"
+	pdebug "github.com/lestrrat/go-pdebug"
+	"github.com/stretchr/testify/assert"
+)
+
+type testOutput struct {
+	messageCh chan *chimera.FluentMessage
+	received  chan string
+}
+
+func (o *testOutput) SetMessageCh(ch chan *chimera.FluentMessage) {
+	o.messageCh = ch
+}
+
+func newTestOutput() *testOutput {
+	return &testOutput{received: make(chan string, 100)}
+}
+
+func (o *testOutput) Run(ctx context.Context, c *chimera.Circumstances) {
+	c.OutputProcess.Add(1)
+	defer c.OutputProcess.Done()
+	c.StartProcess.Done()
+	for m := range o.messageCh {
+		o.received <- m.Tag + ":" + string(m.Message)
+	}
+	close(o.received)
+}
+
+func TestPipeline(t *testing.T) {
+	if pdebug.Enabled {
+		g := pdebug.Marker("TestPipeline")
+		defer g.End()
+	}
+
+	fc, err := chimera.NewFilterChain([]*chimera.ConfigFilter{
+		{
+			Pattern: chimera.MustCompileTagPattern("test.*"),
+			Type:    "grep",
+			Regexp:  &chimera.Regexp{Regexp: regexp.MustCompile(`^keep`)},
+		},
+	})
+	if !assert.NoError(t, err, "NewFilterChain should succeed") {
+		return
+	}
+	c, ctx := chimera.NewCircumstances()
+	pipeline := chimera.NewPipeline(fc)
+	output := newTestOutput()
+	pipeline.AddOutput(output)
+	c.RunProcess(ctx, output, false)
+	c.RunProcess(ctx, pipeline, false)
+	c.StartProcess.Wait()
+
+	for _, m := range []string{"keep 1", "drop 2", "keep 3"} {
+		c.MessageCh <- &chimera.FluentMessage{Tag: "test.foo", Timestamp: time.Now(), Message: []byte(m)}
+	}
+	c.MessageCh <- &chimera.FluentMessage{Tag: "other", Timestamp: time.Now(), Message: []byte("drop 4")}
+	c.Shutdown()
+
+	got := []string{}
+	for r := range output.received {
+		got = append(got, r)
+	}
+	assert.Equal(t, []string{"test.foo:keep 1", "test.foo:keep 3", "other:drop 4"}, got)
+}
+
+func TestPipelineRoute(t *testing.T) {
+	if pdebug.Enabled {
+		g := pdebug.Marker("TestPipelineRoute")
+		defer g.End()
+	}
+
+	c, ctx := chimera.NewCircumstances()
+	pipeline := chimera.NewPipeline(nil)
+	app := newTestOutput()
+	audit := newTestOutput()
+	web := newTestOutput()
+	rest := newTestOutput()
+	pipeline.AddRoute(chimera.MustCompileTagPattern("app.**"), false, app)
+	pipeline.AddRoute(chimera.MustCompileTagPattern("{app,web}.auth"), true, audit)
+	pipeline.AddRoute(chimera.MustCompileTagPattern("web.*"), false, web)
+	pipeline.AddRoute(chimera.MustCompileTagPattern("**"), false, rest)
+	for _, o := range []*testOutput{app, audit, web, rest} {
+		c.RunProcess(ctx, o, false)
+	}
+	c.RunProcess(ctx, pipeline, false)
+	c.StartProcess.Wait()
+
+	for _, tag := range []string{"app.auth", "web.auth", "web.access", "app", "other.auth"} {
+		c.MessageCh <- &chimera.FluentMessage{Tag: tag, Timestamp: time.Now(), Message: []byte("m")}
+	}
+	c.Shutdown()
+
+	expected := map[*testOutput][]string{
+		app:   {"app.auth:m", "app:m"},
+		audit: {"web.auth:m"},
+		web:   {"web.auth:m", "web.access:m"},
+		rest:  {"other.auth:m"},
+	}
+	for o, e := range expected {
+		got := []string{}
+		for r := range o.received {
+			got = append(got, r)
+		}
+		if !assert.Equal(t, e, got) {
+			return
+		}
+	}
+}
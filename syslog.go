@@ -0,0 +1,196 @@
+package chimera
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	syslogFacilities = []string{
+		"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+		"uucp", "cron", "authpriv", "ftp", "ntp", "security", "console", "solaris-cron",
+		"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+	}
+	syslogSeverities = []string{
+		"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug",
+	}
+	syslogSeverityAliases = map[string]int{
+		"panic":    0,
+		"critical": 2,
+		"error":    3,
+		"warn":     4,
+	}
+	syslogRFC3164Regexp = regexp.MustCompile(`^(\S+) (?:([^\s\[:]+)(?:\[([^\]]*)\])?: ?)?(.*)$`)
+)
+
+// parseSyslogFacility returns the facility code of name or number.
+func parseSyslogFacility(s string) (int, error) {
+	s = strings.ToLower(s)
+	for i, name := range syslogFacilities {
+		if s == name {
+			return i, nil
+		}
+	}
+	if n, err := strconv.Atoi(s); err == nil && n >= 0 && n < len(syslogFacilities) {
+		return n, nil
+	}
+	return 0, fmt.Errorf("unknown syslog facility: %q", s)
+}
+
+// parseSyslogSeverity returns the severity code of name or number.
+func parseSyslogSeverity(s string) (int, error) {
+	s = strings.ToLower(s)
+	for i, name := range syslogSeverities {
+		if s == name {
+			return i, nil
+		}
+	}
+	if n, ok := syslogSeverityAliases[s]; ok {
+		return n, nil
+	}
+	if n, err := strconv.Atoi(s); err == nil && n >= 0 && n < len(syslogSeverities) {
+		return n, nil
+	}
+	return 0, fmt.Errorf("unknown syslog severity: %q", s)
+}
+
+// syslogMessage is a message parsed from RFC3164 or RFC5424 format.
+type syslogMessage struct {
+	facility  int
+	severity  int
+	timestamp time.Time
+	host      string
+	ident     string
+	pid       string
+	msgid     string
+	extradata string
+	message   string
+}
+
+// parseSyslogMessage parses b as RFC5424 if the version follows PRI, otherwise as RFC3164.
+// now is used for missing timestamp, and for the year and zone of RFC3164 timestamp.
+func parseSyslogMessage(b []byte, now time.Time) (*syslogMessage, error) {
+	s := string(bytes.TrimRight(b, "\r\n\x00"))
+	if !strings.HasPrefix(s, "<") {
+		return nil, fmt.Errorf("syslog message must start with PRI")
+	}
+	end := strings.IndexByte(s, '>')
+	if end < 2 || end > 4 {
+		return nil, fmt.Errorf("invalid PRI")
+	}
+	pri, err := strconv.Atoi(s[1:end])
+	if err != nil || pri < 0 || pri >= len(syslogFacilities)*8 {
+		return nil, fmt.Errorf("invalid PRI: %q", s[1:end])
+	}
+	m := &syslogMessage{
+		facility:  pri / 8,
+		severity:  pri % 8,
+		timestamp: now,
+	}
+	s = s[end+1:]
+	if strings.HasPrefix(s, "1 ") {
+		return m, m.parseRFC5424(s[2:])
+	}
+	m.parseRFC3164(s)
+	return m, nil
+}
+
+// parseRFC3164 parses "Mmm dd hh:mm:ss HOSTNAME TAG[PID]: MSG" leniently.
+// When the timestamp is missing, whole s is used as the message.
+func (m *syslogMessage) parseRFC3164(s string) {
+	if len(s) < len(time.Stamp)+1 {
+		m.message = s
+		return
+	}
+	t, err := time.ParseInLocation(time.Stamp, s[:len(time.Stamp)], m.timestamp.Location())
+	if err != nil {
+		m.message = s
+		return
+	}
+	now := m.timestamp
+	t = t.AddDate(now.Year(), 0, 0)
+	if t.After(now.AddDate(0, 0, 1)) {
+		// logged in the last year
+		t = t.AddDate(-1, 0, 0)
+	}
+	m.timestamp = t
+
+	matched := syslogRFC3164Regexp.FindStringSubmatch(strings.TrimLeft(s[len(time.Stamp):], " "))
+	if matched == nil {
+		m.message = s[len(time.Stamp):]
+		return
+	}
+	m.host, m.ident, m.pid, m.message = matched[1], matched[2], matched[3], matched[4]
+}
+
+// parseRFC5424 parses "TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA [MSG]".
+func (m *syslogMessage) parseRFC5424(s string) error {
+	fields := strings.SplitN(s, " ", 6)
+	if len(fields) < 6 {
+		return fmt.Errorf("too few fields in RFC5424 message")
+	}
+	if fields[0] != "-" {
+		t, err := time.Parse(time.RFC3339Nano, fields[0])
+		if err != nil {
+			return err
+		}
+		m.timestamp = t
+	}
+	m.host = syslogNilValue(fields[1])
+	m.ident = syslogNilValue(fields[2])
+	m.pid = syslogNilValue(fields[3])
+	m.msgid = syslogNilValue(fields[4])
+
+	rest := fields[5]
+	if strings.HasPrefix(rest, "-") {
+		rest = rest[1:]
+	} else {
+		n, err := syslogStructuredDataLen(rest)
+		if err != nil {
+			return err
+		}
+		m.extradata = rest[:n]
+		rest = rest[n:]
+	}
+	rest = strings.TrimPrefix(rest, " ")
+	m.message = strings.TrimPrefix(rest, "\ufeff")
+	return nil
+}
+
+// syslogStructuredDataLen returns the length of SD-ELEMENTs at the head of s.
+func syslogStructuredDataLen(s string) (int, error) {
+	i := 0
+	for i < len(s) && s[i] == '[' {
+		quoted := false
+		for i++; i < len(s); i++ {
+			if quoted && s[i] == '\\' {
+				i++
+				continue
+			}
+			if s[i] == '"' {
+				quoted = !quoted
+			} else if s[i] == ']' && !quoted {
+				break
+			}
+		}
+		if i >= len(s) {
+			return 0, fmt.Errorf("unterminated structured data")
+		}
+		i++
+	}
+	if i == 0 {
+		return 0, fmt.Errorf("invalid structured data")
+	}
+	return i, nil
+}
+
+func syslogNilValue(s string) string {
+	if s == "-" {
+		return ""
+	}
+	return s
+}
@@ -5,7 +5,9 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
+	"syscall"
 	"time"
 
 	fsnotify "github.com/fsnotify/fsnotify"
@@ -22,6 +24,10 @@ type TargetFile struct {
 	EventCh       chan fsnotify.Event
 	ConfigLogfile *ConfigLogfile
 	Cancel        func()
+	Tag           string
+	Fields        map[string]interface{}
+	// missingSince is when a poll found the followed file missing
+	missingSince time.Time
 }
 
 type Watcher struct {
@@ -31,6 +37,12 @@ type Watcher struct {
 	watchingFile map[string]*TargetFile
 	reverseMap   map[string]string
 	initialized  bool
+	lastPolledAt map[*ConfigLogfile]time.Time
+	degraded     bool
+	// waitingBasedir maps configs whose Basedir does not exist to the nearest existing ancestor watched instead
+	waitingBasedir map[*ConfigLogfile]string
+	followed       *followedFiles
+	tailDoneCh     chan *InTail
 }
 
 func NewWatcher(configLogs []*ConfigLogfile) (*Watcher, error) {
@@ -40,9 +52,18 @@ func NewWatcher(configLogs []*ConfigLogfile) (*Watcher, error) {
 		return nil, err
 	}
 	w := &Watcher{
-		watcher:    watcher,
-		configLogs: configLogs,
-		reverseMap: make(map[string]string),
+		watcher:        watcher,
+		configLogs:     configLogs,
+		reverseMap:     make(map[string]string),
+		lastPolledAt:   make(map[*ConfigLogfile]time.Time),
+		waitingBasedir: make(map[*ConfigLogfile]string),
+		followed:       newFollowedFiles(),
+		tailDoneCh:     make(chan *InTail),
+	}
+	for _, config := range configLogs {
+		if config.FileTimeFormat != "" && targetFileDateGroup(config) < 0 {
+			log.Println("[warn] TargetFileRegexp has no date group for FileTimeFormat. files are followed across rotation:", config.TargetFileRegexp)
+		}
 	}
 	return w, nil
 }
@@ -56,23 +77,32 @@ func (w *Watcher) Run(ctx context.Context, c *Circumstances) {
 		return
 	}
 
-	if len(w.watchingDir) == 0 && len(w.watchingFile) == 0 {
+	if len(w.watchingDir) == 0 && len(w.watchingFile) == 0 && len(w.waitingBasedir) == 0 {
 		// no need to watch
 		log.Println("[warn] nothing to watch")
 		return
 	}
 
+	// the ticker runs always, because reconciliation may be started by errors of fsnotify
+	ticker := time.NewTicker(w.rescanTickInterval())
+	defer ticker.Stop()
+
 	log.Println("[info] start file watcher")
 	for {
 		select {
 		case <-ctx.Done():
 			log.Println("[info] shutdown file watcher")
 			return
+		case now := <-ticker.C:
+			w.pollAll(ctx, c, now)
 		case ev := <-w.watcher.Events:
 			log.Println("[debug] watcher event", ev)
 			w.dispatchWatcherEvent(ctx, c, ev)
 		case err := <-w.watcher.Errors:
 			log.Println("[warn] watcher error", err)
+			w.onWatcherError(ctx, c, err)
+		case tail := <-w.tailDoneCh:
+			w.onTailDone(ctx, c, tail)
 		}
 	}
 }
@@ -84,7 +114,7 @@ func (w *Watcher) dispatchWatcherEvent(ctx context.Context, c *Circumstances, ev
 	case ev.Op&fsnotify.Remove == fsnotify.Remove:
 		fallthrough
 	case ev.Op&fsnotify.Rename == fsnotify.Rename:
-		w.onDeleteOrRename(ev)
+		w.onDeleteOrRename(ctx, c, ev)
 	case ev.Op&fsnotify.Write == fsnotify.Write:
 		w.onModify(ev)
 	}
@@ -94,13 +124,23 @@ func (w *Watcher) onCreate(ctx context.Context, c *Circumstances, ev fsnotify.Ev
 	stat, err := os.Stat(ev.Name)
 	if err != nil {
 		log.Println("[warn] failed to retrieve Stat for", ev.Name)
+		return
 	}
 
-	if stat.IsDir() {
+	parent := filepath.Dir(ev.Name)
+	_, watching := w.watchingDir[parent]
+	switch {
+	case !watching && w.isWaitingAncestor(parent):
+		// created in the ancestor of the missing Basedir
+	case stat.IsDir():
 		w.onNewDirectory(ctx, c, ev.Name)
-	} else {
+	default:
 		w.onNewFile(ctx, c, ev.Name)
 	}
+	if stat.IsDir() {
+		// Basedir may be created also under directories watched for other configs
+		w.checkBasedirs(ctx, c)
+	}
 }
 
 func (w *Watcher) onNewDirectory(ctx context.Context, c *Circumstances, path string) {
@@ -118,13 +158,7 @@ func (w *Watcher) onNewDirectory(ctx context.Context, c *Circumstances, path str
 				log.Println("[warn] something wrong at startWatchAndTail.", err)
 				return
 			}
-			for path, target := range foundDir {
-				w.watchingDir[path] = target
-			}
-			for name, target := range foundFile {
-				w.watchingFile[name] = target
-				w.reverseMap[target.Name] = name
-			}
+			w.mergeTargets(foundDir, foundFile)
 		}
 	} else {
 		log.Println("[warn] watchingDir may be corrupted.")
@@ -139,21 +173,31 @@ func (w *Watcher) onNewFile(ctx context.Context, c *Circumstances, path string)
 			findFile(path, config, foundFile)
 		}
 		for name, target := range foundFile {
-			if current, ok := w.watchingFile[name]; ok {
-				if !target.Timestamp.After(current.Timestamp) {
-					continue
-				}
-				w.unwatchFile(name)
-			}
-			w.watchingFile[name] = target
-			w.reverseMap[target.Name] = name
-			w.runTail(ctx, c, target)
+			w.watchNewFile(ctx, c, name, target)
 		}
 	} else {
 		log.Println("[warn] watchingDir may be corrupted.")
 	}
 }
 
+// watchNewFile starts tailing target, unless the file of the same name is tailed and not older.
+// It returns true when target is started.
+func (w *Watcher) watchNewFile(ctx context.Context, c *Circumstances, name string, target *TargetFile) bool {
+	if current, ok := w.watchingFile[name]; ok {
+		if !target.Timestamp.After(current.Timestamp) {
+			return false
+		}
+		w.unwatchFile(name)
+	}
+	if err := w.runTail(ctx, c, target); err != nil {
+		log.Println("[error]", err)
+		return false
+	}
+	w.watchingFile[name] = target
+	w.reverseMap[target.Name] = name
+	return true
+}
+
 func (w *Watcher) onModify(ev fsnotify.Event) {
 	stat, err := os.Stat(ev.Name)
 	if err != nil {
@@ -171,14 +215,231 @@ func (w *Watcher) onModify(ev fsnotify.Event) {
 	}
 }
 
-func (w *Watcher) onDeleteOrRename(ev fsnotify.Event) {
+func (w *Watcher) onDeleteOrRename(ctx context.Context, c *Circumstances, ev fsnotify.Event) {
 	if _, ok := w.watchingDir[ev.Name]; ok {
 		w.unwatchDir(ev.Name)
+		w.checkBasedirs(ctx, c)
+	} else if w.isWaitingAncestor(ev.Name) {
+		w.checkBasedirs(ctx, c)
 	} else if name, ok := w.reverseMap[ev.Name]; ok {
+		target, ok := w.watchingFile[name]
+		if ok && ev.Op&fsnotify.Rename == fsnotify.Rename && followsRotation(target.ConfigLogfile) {
+			// in_tail follows the renamed file until drained, and reopens the path
+			return
+		}
 		w.unwatchFile(name)
 	}
 }
 
+// onTailDone unwatches the file whose in_tail has stopped by itself, and tails it again if it has come back.
+func (w *Watcher) onTailDone(ctx context.Context, c *Circumstances, tail *InTail) {
+	for name, target := range w.watchingFile {
+		if target.EventCh != tail.eventCh {
+			continue
+		}
+		log.Println("[info] Unwatching File:", target.Name)
+		w.unwatchFile(name)
+		if _, err := os.Stat(target.Name); err == nil {
+			w.onNewFile(ctx, c, target.Name)
+		}
+		return
+	}
+}
+
+// rescanInterval returns the interval to rescan files of config, and whether the rescan is reconciliation,
+// which reports discrepancies from fsnotify events. It returns 0 when config is not rescanned.
+func (w *Watcher) rescanInterval(config *ConfigLogfile) (time.Duration, bool) {
+	if d := config.PollInterval.Duration; d > 0 {
+		return d, false
+	}
+	if d := config.ReconcileInterval.Duration; d > 0 {
+		return d, true
+	}
+	if w.degraded {
+		return DefaultReconcileInterval, true
+	}
+	return 0, false
+}
+
+// rescanTickInterval returns the shortest interval to rescan.
+func (w *Watcher) rescanTickInterval() time.Duration {
+	interval := DefaultReconcileInterval
+	for _, config := range w.configLogs {
+		for _, d := range []time.Duration{config.PollInterval.Duration, config.ReconcileInterval.Duration} {
+			if d > 0 && d < interval {
+				interval = d
+			}
+		}
+	}
+	return interval
+}
+
+// pollAll rescans configs whose interval has elapsed.
+func (w *Watcher) pollAll(ctx context.Context, c *Circumstances, now time.Time) {
+	// Basedir may be created or deleted without fsnotify events
+	w.checkBasedirs(ctx, c)
+	for _, config := range w.configLogs {
+		if _, ok := w.waitingBasedir[config]; ok {
+			continue
+		}
+		interval, reconcile := w.rescanInterval(config)
+		if interval <= 0 {
+			continue
+		}
+		// tolerate the jitter of the ticker
+		if now.Sub(w.lastPolledAt[config]) < interval*9/10 {
+			continue
+		}
+		w.lastPolledAt[config] = now
+		result := w.poll(ctx, c, config)
+		if reconcile {
+			w.reportRescan(c, config, result)
+		}
+	}
+}
+
+// rescanAll rescans all configs at once, when fsnotify events may be lost.
+func (w *Watcher) rescanAll(ctx context.Context, c *Circumstances) {
+	now := time.Now()
+	w.checkBasedirs(ctx, c)
+	for _, config := range w.configLogs {
+		if _, ok := w.waitingBasedir[config]; ok {
+			continue
+		}
+		w.lastPolledAt[config] = now
+		w.reportRescan(c, config, w.poll(ctx, c, config))
+	}
+}
+
+// onWatcherError rescans all files on the overflow of fsnotify events, and starts reconciliation
+// on errors of fsnotify, e.g. ENOSPC by fs.inotify.max_user_watches.
+func (w *Watcher) onWatcherError(ctx context.Context, c *Circumstances, err error) {
+	if !w.degraded {
+		log.Println("[warn] start reconciliation every", DefaultReconcileInterval, "because of watcher error")
+		w.degraded = true
+	}
+	if err == fsnotify.ErrEventOverflow {
+		c.MonitorCh <- &InputStat{
+			Input:  "watcher",
+			Counts: map[string]int64{"overflows": 1},
+		}
+		w.rescanAll(ctx, c)
+		return
+	}
+	if err == syscall.ENOSPC {
+		log.Println("[warn] too many watches. consider increasing fs.inotify.max_user_watches")
+	}
+	c.MonitorCh <- &InputStat{
+		Input:  "watcher",
+		Counts: map[string]int64{"errors": 1},
+	}
+}
+
+// addWatch adds path to fsnotify, and reports the failure as a watcher error.
+func (w *Watcher) addWatch(ctx context.Context, c *Circumstances, path string) {
+	if err := w.watcher.Add(path); err != nil {
+		log.Println("[warn] failed to watch", path, err)
+		w.onWatcherError(ctx, c, err)
+	}
+}
+
+// pollResult is the discrepancies between a rescan and watchingDir/watchingFile.
+type pollResult struct {
+	missedDirs  int64
+	staleDirs   int64
+	missedFiles int64
+	staleFiles  int64
+}
+
+func (w *Watcher) reportRescan(c *Circumstances, config *ConfigLogfile, result *pollResult) {
+	if *result != (pollResult{}) {
+		log.Printf(
+			"[warn] rescan of %s found discrepancies. missed dirs: %d, stale dirs: %d, missed files: %d, stale files: %d\n",
+			config.Basedir, result.missedDirs, result.staleDirs, result.missedFiles, result.staleFiles,
+		)
+	}
+	c.MonitorCh <- &InputStat{
+		Input: "watcher",
+		Counts: map[string]int64{
+			"rescans":      1,
+			"missed_dirs":  result.missedDirs,
+			"stale_dirs":   result.staleDirs,
+			"missed_files": result.missedFiles,
+			"stale_files":  result.staleFiles,
+		},
+	}
+}
+
+// poll rescans Basedir of config, and diffs the result against watchingDir and watchingFile,
+// for filesystems on which fsnotify events never arrive, or fsnotify events are lost.
+func (w *Watcher) poll(ctx context.Context, c *Circumstances, config *ConfigLogfile) *pollResult {
+	result := &pollResult{}
+	foundDir := make(map[string]*TargetDir)
+	foundFile := make(map[string]*TargetFile)
+	if err := findWatchTargets(config.Basedir, config, foundDir, foundFile); err != nil {
+		log.Println("[warn] failed to poll", config.Basedir, err)
+	}
+
+	for path := range foundDir {
+		if target, ok := w.watchingDir[path]; ok {
+			if !hasConfigLogfile(target.ConfigLogs, config) {
+				target.ConfigLogs = append(target.ConfigLogs, config)
+			}
+			continue
+		}
+		log.Printf("[info] Watching Dir: path => %v, config => %v\n", path, config)
+		w.watchingDir[path] = foundDir[path]
+		w.addWatch(ctx, c, path)
+		result.missedDirs++
+	}
+	for path, target := range w.watchingDir {
+		if _, ok := foundDir[path]; ok || !hasConfigLogfile(target.ConfigLogs, config) {
+			continue
+		}
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			w.unwatchDir(path)
+			result.staleDirs++
+		}
+	}
+
+	now := time.Now()
+	for name, target := range w.watchingFile {
+		if target.ConfigLogfile != config {
+			continue
+		}
+		if _, err := os.Stat(target.Name); !os.IsNotExist(err) {
+			target.missingSince = time.Time{}
+			continue
+		}
+		if followsRotation(config) {
+			// followed files may be reopened by in_tail within RotateWait
+			if target.missingSince.IsZero() {
+				target.missingSince = now
+			}
+			if now.Sub(target.missingSince) < config.RotateWait.Duration {
+				continue
+			}
+		}
+		w.unwatchFile(name)
+		result.staleFiles++
+	}
+	for name, target := range foundFile {
+		if w.watchNewFile(ctx, c, name, target) {
+			result.missedFiles++
+		}
+	}
+	return result
+}
+
+func hasConfigLogfile(configLogs []*ConfigLogfile, config *ConfigLogfile) bool {
+	for _, c := range configLogs {
+		if c == config {
+			return true
+		}
+	}
+	return false
+}
+
 func (w *Watcher) unwatchDir(path string) {
 	for name := range w.watchingFile {
 		if strings.HasPrefix(name, path+"/") {
@@ -209,8 +470,17 @@ func (w *Watcher) initialize(ctx context.Context, c *Circumstances) error {
 	defer c.StartProcess.Done()
 	defer func() { w.initialized = true }()
 
+	configLogs := make([]*ConfigLogfile, 0, len(w.configLogs))
+	for _, config := range w.configLogs {
+		if _, err := os.Stat(config.Basedir); os.IsNotExist(err) {
+			w.waitBasedir(ctx, c, config)
+			continue
+		}
+		configLogs = append(configLogs, config)
+	}
+
 	var err error
-	w.watchingDir, w.watchingFile, err = w.startWatchAndTail(ctx, c, "", w.configLogs)
+	w.watchingDir, w.watchingFile, err = w.startWatchAndTail(ctx, c, "", configLogs)
 	if err != nil {
 		return err
 	}
@@ -221,6 +491,114 @@ func (w *Watcher) initialize(ctx context.Context, c *Circumstances) error {
 	return nil
 }
 
+// mergeTargets adds found directories and files to watchingDir and watchingFile.
+func (w *Watcher) mergeTargets(foundDir map[string]*TargetDir, foundFile map[string]*TargetFile) {
+	for path, target := range foundDir {
+		if current, ok := w.watchingDir[path]; ok {
+			for _, config := range target.ConfigLogs {
+				if !hasConfigLogfile(current.ConfigLogs, config) {
+					current.ConfigLogs = append(current.ConfigLogs, config)
+				}
+			}
+			continue
+		}
+		w.watchingDir[path] = target
+	}
+	for name, target := range foundFile {
+		w.watchingFile[name] = target
+		w.reverseMap[target.Name] = name
+	}
+}
+
+// waitBasedir watches the nearest existing ancestor of Basedir of config, until Basedir is created.
+func (w *Watcher) waitBasedir(ctx context.Context, c *Circumstances, config *ConfigLogfile) {
+	ancestor := nearestExistingDir(config.Basedir)
+	if current, ok := w.waitingBasedir[config]; ok {
+		if current == ancestor {
+			return
+		}
+		delete(w.waitingBasedir, config)
+		w.releaseAncestor(current)
+	}
+	log.Println("[info]", config.Basedir, "does not exist. waiting for it under", ancestor)
+	if _, ok := w.watchingDir[ancestor]; !ok && !w.isWaitingAncestor(ancestor) {
+		w.addWatch(ctx, c, ancestor)
+	}
+	w.waitingBasedir[config] = ancestor
+}
+
+// releaseAncestor removes the watch of ancestor, unless it is watched for others.
+func (w *Watcher) releaseAncestor(ancestor string) {
+	if _, ok := w.watchingDir[ancestor]; ok || w.isWaitingAncestor(ancestor) {
+		return
+	}
+	w.watcher.Remove(ancestor)
+}
+
+func (w *Watcher) isWaitingAncestor(path string) bool {
+	for _, ancestor := range w.waitingBasedir {
+		if ancestor == path {
+			return true
+		}
+	}
+	return false
+}
+
+// checkBasedirs starts watching Basedir which has been created, and waits for Basedir which has been deleted.
+func (w *Watcher) checkBasedirs(ctx context.Context, c *Circumstances) {
+	for _, config := range w.configLogs {
+		_, err := os.Stat(config.Basedir)
+		exists := err == nil
+		ancestor, waiting := w.waitingBasedir[config]
+		switch {
+		case waiting && exists:
+			log.Println("[info]", config.Basedir, "was created")
+			delete(w.waitingBasedir, config)
+			w.releaseAncestor(ancestor)
+			foundDir, foundFile, err := w.startWatchAndTail(ctx, c, "", []*ConfigLogfile{config})
+			if err != nil {
+				log.Println("[warn] something wrong at startWatchAndTail.", err)
+				w.waitBasedir(ctx, c, config)
+				continue
+			}
+			w.mergeTargets(foundDir, foundFile)
+		case waiting || !exists:
+			// deleted, or created nearer ancestor
+			if !waiting {
+				w.unwatchConfig(config)
+			}
+			w.waitBasedir(ctx, c, config)
+		}
+	}
+}
+
+// unwatchConfig unwatches files of config, whose Basedir has been deleted.
+func (w *Watcher) unwatchConfig(config *ConfigLogfile) {
+	for name, target := range w.watchingFile {
+		if target.ConfigLogfile == config {
+			w.unwatchFile(name)
+		}
+	}
+	if _, ok := w.watchingDir[config.Basedir]; ok {
+		w.unwatchDir(config.Basedir)
+	}
+}
+
+// nearestExistingDir returns path or its nearest ancestor which exists.
+func nearestExistingDir(path string) string {
+	dir := filepath.Clean(path)
+	for {
+		if stat, err := os.Stat(dir); err == nil && stat.IsDir() {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir
+		}
+		dir = parent
+	}
+}
+
 func (w *Watcher) startWatchAndTail(ctx context.Context, c *Circumstances, basedir string, configLogs []*ConfigLogfile) (map[string]*TargetDir, map[string]*TargetFile, error) {
 	founDir := make(map[string]*TargetDir)
 	foundFile := make(map[string]*TargetFile)
@@ -238,20 +616,25 @@ func (w *Watcher) startWatchAndTail(ctx context.Context, c *Circumstances, based
 	}
 
 	// start in_tail
-	for _, target := range foundFile {
-		w.runTail(ctx, c, target)
+	for name, target := range foundFile {
+		if err := w.runTail(ctx, c, target); err != nil {
+			log.Println("[error]", err)
+			delete(foundFile, name)
+		}
 	}
 
 	// start watch
 	for path, target := range founDir {
 		log.Printf("[info] Watching Dir: path => %v, config => %v\n", path, target.ConfigLogs)
-		w.watcher.Add(path)
+		w.addWatch(ctx, c, path)
 	}
 
 	return founDir, foundFile, nil
 }
 
-func (w *Watcher) runTail(ctx context.Context, c *Circumstances, target *TargetFile) {
+// runTail starts in_tail of target, and sets EventCh and Cancel of target.
+// target must not be watched when it returns an error.
+func (w *Watcher) runTail(ctx context.Context, c *Circumstances, target *TargetFile) error {
 	eventCh := make(chan fsnotify.Event)
 	position := SEEK_HEAD
 	if !w.initialized {
@@ -260,13 +643,22 @@ func (w *Watcher) runTail(ctx context.Context, c *Circumstances, target *TargetF
 	tail, err := NewInTail(target.Name, target.ConfigLogfile, eventCh, position)
 	if err != nil {
 		close(eventCh)
-		log.Println("[error]", err)
-	} else {
-		childCtx, cancel := context.WithCancel(ctx)
-		target.Cancel = cancel
-		target.EventCh = eventCh
-		c.RunProcess(childCtx, tail, true)
+		return err
 	}
+	if target.Tag != "" {
+		tail.tag = target.Tag
+	}
+	tail.fields = target.Fields
+	tail.follow = followsRotation(target.ConfigLogfile)
+	if tail.follow {
+		tail.followed = w.followed
+	}
+	tail.doneCh = w.tailDoneCh
+	childCtx, cancel := context.WithCancel(ctx)
+	target.Cancel = cancel
+	target.EventCh = eventCh
+	c.RunProcess(childCtx, tail, true)
+	return nil
 }
 
 func findWatchTargets(basedir string, config *ConfigLogfile, foundDir map[string]*TargetDir, foundFile map[string]*TargetFile) error {
@@ -281,6 +673,10 @@ func findWatchTargets(basedir string, config *ConfigLogfile, foundDir map[string
 			if !config.Recursive && path != basedir {
 				return filepath.SkipDir
 			}
+			if config.prunedDir(path) {
+				log.Println("[debug] pruned:", path)
+				return filepath.SkipDir
+			}
 			findDir(path, config, foundDir)
 		} else {
 			if err := findFile(path, config, foundFile); err != nil {
@@ -298,15 +694,27 @@ func findWatchTargets(basedir string, config *ConfigLogfile, foundDir map[string
 }
 
 func findFile(path string, config *ConfigLogfile, foundFile map[string]*TargetFile) error {
+	if config.excluded(path) {
+		return nil
+	}
+	if config.Kubernetes {
+		findKubernetesFile(path, config, foundFile)
+		return nil
+	}
+	i := targetFileDateGroup(config)
+	if i < 0 {
+		findUndatedFile(path, config, foundFile)
+		return nil
+	}
 	ret := config.TargetFileRegexp.FindStringSubmatchIndex(path)
-	if len(ret) > 3 {
-		dateStr := path[ret[2]:ret[3]]
+	if ret != nil && ret[2*i] >= 0 {
+		dateStr := path[ret[2*i]:ret[2*i+1]]
 		date, err := time.Parse(config.FileTimeFormat, dateStr)
 		if err != nil {
 			log.Println("[warn] FileTimeFormat and/or TargetFileRegexp is invalid.", err)
 			return nil
 		}
-		baseName := path[ret[0]:ret[2]] + path[ret[3]:] + ":" + config.FileTimeFormat
+		baseName := path[ret[0]:ret[2*i]] + path[ret[2*i+1]:] + ":" + config.FileTimeFormat
 
 		current, ok := foundFile[baseName]
 		if ok {
@@ -314,15 +722,123 @@ func findFile(path string, config *ConfigLogfile, foundFile map[string]*TargetFi
 				path = current.Name
 			}
 		}
-		foundFile[baseName] = &TargetFile{
+		target := &TargetFile{
 			Name:          path,
 			Timestamp:     date,
 			ConfigLogfile: config,
 		}
+		if captures := targetFileCaptures(config.TargetFileRegexp.Regexp, path, i); len(captures) > 0 {
+			target.Fields = make(map[string]interface{}, len(captures))
+			for name, value := range captures {
+				target.Fields[name] = value
+			}
+			target.Tag = expandTagTemplate(config.Tag, captures)
+		}
+		foundFile[baseName] = target
 	}
 	return nil
 }
 
+// targetFileDateGroup returns the index of the date group in TargetFileRegexp of config.
+// It is the group named "date", or the first group when it is not named.
+// When FileTimeFormat is set, it is the first unnamed group following named groups,
+// or the only group of any name, as before named groups were supported.
+// It returns -1 when TargetFileRegexp has no date group.
+func targetFileDateGroup(config *ConfigLogfile) int {
+	names := config.TargetFileRegexp.SubexpNames()
+	for i, name := range names {
+		if name == "date" {
+			return i
+		}
+	}
+	if len(names) > 1 && names[1] == "" {
+		return 1
+	}
+	if config.FileTimeFormat == "" {
+		return -1
+	}
+	for i := 2; i < len(names); i++ {
+		if names[i] == "" {
+			return i
+		}
+	}
+	if len(names) == 2 {
+		return 1
+	}
+	return -1
+}
+
+// targetFileCaptures returns values of named groups other than the date group at dateGroup matched with path.
+func targetFileCaptures(re *regexp.Regexp, path string, dateGroup int) map[string]string {
+	m := re.FindStringSubmatch(path)
+	if m == nil {
+		return nil
+	}
+	captures := make(map[string]string)
+	for i, name := range re.SubexpNames() {
+		if name != "" && i != dateGroup {
+			captures[name] = m[i]
+		}
+	}
+	return captures
+}
+
+// expandTagTemplate replaces ${name} in tag with captures.
+func expandTagTemplate(tag string, captures map[string]string) string {
+	for name, value := range captures {
+		tag = strings.Replace(tag, "${"+name+"}", value, -1)
+	}
+	return tag
+}
+
+// findUndatedFile finds a file matched with TargetFileRegexp without the date group.
+// Every matched file is tailed, and followed by its path across rotation.
+func findUndatedFile(path string, config *ConfigLogfile, foundFile map[string]*TargetFile) {
+	captures := targetFileCaptures(config.TargetFileRegexp.Regexp, path, -1)
+	if captures == nil {
+		return
+	}
+	target := &TargetFile{
+		Name:          path,
+		ConfigLogfile: config,
+	}
+	if len(captures) > 0 {
+		target.Fields = make(map[string]interface{}, len(captures))
+		for name, value := range captures {
+			target.Fields[name] = value
+		}
+		target.Tag = expandTagTemplate(config.Tag, captures)
+	}
+	foundFile[path] = target
+}
+
+// followsRotation reports whether files of config are followed by their paths across rotation,
+// instead of switching to the file of the newer date.
+func followsRotation(config *ConfigLogfile) bool {
+	return config.Kubernetes || targetFileDateGroup(config) < 0
+}
+
+// findKubernetesFile finds a container log file, whose name has the metadata instead of the date.
+func findKubernetesFile(path string, config *ConfigLogfile, foundFile map[string]*TargetFile) {
+	if !config.TargetFileRegexp.MatchString(path) {
+		return
+	}
+	meta, ok := parseKubernetesFileName(path)
+	if !ok {
+		log.Println("[debug]", path, "is not a kubernetes container log")
+		return
+	}
+	target := &TargetFile{
+		Name:          path,
+		ConfigLogfile: config,
+		Fields:        meta.Fields(),
+	}
+	if config.KubernetesTag {
+		target.Tag = meta.Tag(config.Tag)
+	}
+	foundFile[path] = target
+}
+
 func findDir(path string, config *ConfigLogfile, foundDir map[string]*TargetDir) {
 	target, ok := foundDir[path]
 	if ok {
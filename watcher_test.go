@@ -10,6 +10,7 @@ import (
 	"testing"
 	"time"
 
+	fsnotify "github.com/fsnotify/fsnotify"
 	pdebug "github.com/lestrrat/go-pdebug"
 	"github.com/stretchr/testify/assert"
 )
@@ -303,3 +304,637 @@ func check(t *testing.T, w *Watcher, tmpdir string, expectDir []string, expectFi
 		}
 	}
 }
+
+func TestFindKubernetesFile(t *testing.T) {
+	if pdebug.Enabled {
+		g := pdebug.Marker("TestFindKubernetesFile")
+		defer g.End()
+	}
+
+	config := &ConfigLogfile{
+		Tag:           "kube",
+		Basedir:       "/var/log/containers",
+		KubernetesTag: true,
+	}
+	config.Restrict(&Config{})
+
+	id := strings.Repeat("0123456789abcdef", 4)
+	foundFile := make(map[string]*TargetFile)
+	for _, path := range []string{
+		"/var/log/containers/web-5d8f9c-x2z_default_nginx-" + id + ".log",
+		"/var/log/containers/not-a-container.log",
+		"/var/log/containers/web_default_nginx-" + id + ".txt",
+	} {
+		if !assert.NoError(t, findFile(path, config, foundFile)) {
+			return
+		}
+	}
+	if !assert.Len(t, foundFile, 1) {
+		return
+	}
+	target := foundFile["/var/log/containers/web-5d8f9c-x2z_default_nginx-"+id+".log"]
+	if !assert.NotNil(t, target) {
+		return
+	}
+	if !assert.Equal(t, "kube.default.web-5d8f9c-x2z.nginx", target.Tag) {
+		return
+	}
+	assert.Equal(t, map[string]interface{}{
+		"pod_name":       "web-5d8f9c-x2z",
+		"namespace_name": "default",
+		"container_name": "nginx",
+		"container_id":   id,
+	}, target.Fields)
+}
+
+func TestFindFileNamedGroups(t *testing.T) {
+	if pdebug.Enabled {
+		g := pdebug.Marker("TestFindFileNamedGroups")
+		defer g.End()
+	}
+
+	config := &ConfigLogfile{
+		Tag:              "app.${app}",
+		Basedir:          "/var/log/services",
+		TargetFileRegexp: &Regexp{regexp.MustCompile(`^/var/log/services/(?P<app>[^/]+)/(?P<role>[^/_]+)_(?P<date>\d{8})\.log$`)},
+		FileTimeFormat:   "20060102",
+		DedupeWindow:     Duration{Duration: time.Second},
+	}
+	c := &Config{Logs: []*ConfigLogfile{config}}
+	config.Restrict(c)
+
+	foundFile := make(map[string]*TargetFile)
+	for _, path := range []string{
+		"/var/log/services/api/web_20180101.log",
+		"/var/log/services/api/web_20180102.log",
+		"/var/log/services/batch/worker_20180102.log",
+	} {
+		if !assert.NoError(t, findFile(path, config, foundFile)) {
+			return
+		}
+	}
+	if !assert.Len(t, foundFile, 2) {
+		return
+	}
+	for _, target := range foundFile {
+		switch target.Name {
+		case "/var/log/services/api/web_20180102.log":
+			if !assert.Equal(t, "app.api", target.Tag) {
+				return
+			}
+			if !assert.Equal(t, map[string]interface{}{"app": "api", "role": "web"}, target.Fields) {
+				return
+			}
+		case "/var/log/services/batch/worker_20180102.log":
+			if !assert.Equal(t, "app.batch", target.Tag) {
+				return
+			}
+		default:
+			t.Error("unexpected target", target.Name)
+			return
+		}
+	}
+
+	filters, err := c.FilterConfigs()
+	if !assert.NoError(t, err) {
+		return
+	}
+	if !assert.Len(t, filters, 1) {
+		return
+	}
+	if !assert.True(t, filters[0].Pattern.Match("app.api")) {
+		return
+	}
+	assert.False(t, filters[0].Pattern.Match("other.api"))
+}
+
+func TestFindWatchTargetsPruned(t *testing.T) {
+	if pdebug.Enabled {
+		g := pdebug.Marker("TestFindWatchTargetsPruned")
+		defer g.End()
+	}
+
+	tmpdir, _ := ioutil.TempDir(os.TempDir(), "chimera-test")
+	defer os.RemoveAll(tmpdir)
+	for _, f := range []string{
+		"app/a.log",
+		"app/x/b.log",
+		"app/x/y/c.log",
+		"app/archive/d.log",
+		"app/x/cache/e.log",
+		"app/tmp/f.log",
+		"app/logs.old/g.log",
+	} {
+		createFile(tmpdir, f)
+	}
+
+	var excludePath []*PathPattern
+	for _, pattern := range []string{
+		"**/archive",                     // glob matched with the full path
+		`^.+/cache$`,                     // regexp
+		filepath.Join(tmpdir, "app/tmp"), // glob of the absolute path
+		"*.old",                          // glob matched with the base name
+	} {
+		p := &PathPattern{}
+		if !assert.NoError(t, p.UnmarshalText([]byte(pattern)), pattern) {
+			return
+		}
+		excludePath = append(excludePath, p)
+	}
+	config := &ConfigLogfile{
+		Path:        filepath.Join(tmpdir, "app/**/*.log"),
+		ExcludePath: excludePath,
+		MaxDepth:    1,
+	}
+	config.Restrict(&Config{})
+
+	basedir := filepath.Join(tmpdir, "app")
+	foundDir := make(map[string]*TargetDir)
+	foundFile := make(map[string]*TargetFile)
+	if !assert.NoError(t, findWatchTargets(basedir, config, foundDir, foundFile)) {
+		return
+	}
+	dirs := make([]string, 0, len(foundDir))
+	for dir := range foundDir {
+		rel, _ := filepath.Rel(tmpdir, dir)
+		dirs = append(dirs, rel)
+	}
+	assert.ElementsMatch(t, []string{"app", "app/x"}, dirs)
+	files := make([]string, 0, len(foundFile))
+	for _, target := range foundFile {
+		rel, _ := filepath.Rel(tmpdir, target.Name)
+		files = append(files, rel)
+	}
+	assert.ElementsMatch(t, []string{"app/a.log", "app/x/b.log"}, files)
+
+	// directories created later are walked from themselves
+	foundDir = make(map[string]*TargetDir)
+	foundFile = make(map[string]*TargetFile)
+	for _, dir := range []string{"app/x/y", "app/archive"} {
+		if !assert.NoError(t, findWatchTargets(filepath.Join(tmpdir, dir), config, foundDir, foundFile)) {
+			return
+		}
+	}
+	assert.Empty(t, foundDir)
+	assert.Empty(t, foundFile)
+}
+
+func TestWatcherPoll(t *testing.T) {
+	if pdebug.Enabled {
+		g := pdebug.Marker("TestWatcherPoll")
+		defer g.End()
+	}
+
+	tmpdir, _ := ioutil.TempDir(os.TempDir(), "chimera-test")
+	defer os.RemoveAll(tmpdir)
+	prepareFiles(tmpdir)
+
+	configs := newConfigLogfiles(tmpdir)
+	c, ctx := NewCircumstances()
+	w, err := NewWatcher(configs)
+	if !assert.NoError(t, err, "Watcher should be created.") {
+		return
+	}
+	// no fsnotify events are dispatched, as on filesystems without inotify
+	go func() {
+		for range w.watcher.Events {
+		}
+	}()
+	go func() {
+		for range c.MonitorCh {
+		}
+	}()
+	c.StartProcess.Add(1)
+	if !assert.NoError(t, w.initialize(ctx, c)) {
+		return
+	}
+	defer c.Shutdown()
+
+	createFile(tmpdir, "recursive/test1/bar20180103.log")
+	createFile(tmpdir, "recursive/test4/new_20180101.log")
+	os.Remove(filepath.Join(tmpdir, "recursive/test3/baz_20180102.log"))
+	os.RemoveAll(filepath.Join(tmpdir, "recursive/test3/test33"))
+	for _, config := range configs {
+		w.poll(ctx, c, config)
+	}
+
+	expectDir := []string{
+		"recursive",
+		"recursive/test1",
+		"recursive/test1/test11",
+		"recursive/test2",
+		"recursive/test3",
+		"recursive/test4",
+		"nonrecursive",
+	}
+	expectFile := []string{
+		"recursive/test1/foo_20180103.log",
+		"recursive/test1/bar20180103.log",
+		"recursive/test1/log-20180102",
+		"recursive/test1/test11/foo_20180102.log",
+		"recursive/test3/baz_20180101.log",
+		"recursive/test4/new_20180101.log",
+		"nonrecursive/foo_20180102.log",
+	}
+	check(t, w, tmpdir, expectDir, expectFile)
+}
+
+func TestWatcherRescanOnOverflow(t *testing.T) {
+	if pdebug.Enabled {
+		g := pdebug.Marker("TestWatcherRescanOnOverflow")
+		defer g.End()
+	}
+
+	tmpdir, _ := ioutil.TempDir(os.TempDir(), "chimera-test")
+	defer os.RemoveAll(tmpdir)
+	prepareFiles(tmpdir)
+
+	c, ctx := NewCircumstances()
+	w, err := NewWatcher(newConfigLogfiles(tmpdir))
+	if !assert.NoError(t, err, "Watcher should be created.") {
+		return
+	}
+	// events are lost
+	go func() {
+		for range w.watcher.Events {
+		}
+	}()
+	c.StartProcess.Add(1)
+	if !assert.NoError(t, w.initialize(ctx, c)) {
+		return
+	}
+	defer c.Shutdown()
+
+	createFile(tmpdir, "recursive/test4/new_20180101.log")
+	os.Remove(filepath.Join(tmpdir, "nonrecursive/foo_20180102.log"))
+	w.onWatcherError(ctx, c, fsnotify.ErrEventOverflow)
+
+	if !assert.True(t, w.degraded, "reconciliation should be started") {
+		return
+	}
+	interval, reconcile := w.rescanInterval(w.configLogs[0])
+	if !assert.Equal(t, DefaultReconcileInterval, interval) || !assert.True(t, reconcile) {
+		return
+	}
+
+	counts := make(map[string]int64)
+	timeout := time.After(time.Second)
+	for counts["rescans"] < 2 {
+		select {
+		case s := <-c.MonitorCh:
+			if stat, ok := s.(*InputStat); ok && stat.Input == "watcher" {
+				for key, n := range stat.Counts {
+					counts[key] += n
+				}
+			}
+		case <-timeout:
+			t.Error("timed out. counts", counts)
+			return
+		}
+	}
+	assert.Equal(t, map[string]int64{
+		"overflows":    1,
+		"rescans":      2,
+		"missed_dirs":  1,
+		"stale_dirs":   0,
+		"missed_files": 1,
+		"stale_files":  1,
+	}, counts)
+}
+
+func TestWatcherWaitBasedir(t *testing.T) {
+	if pdebug.Enabled {
+		g := pdebug.Marker("TestWatcherWaitBasedir")
+		defer g.End()
+	}
+
+	tmpdir, _ := ioutil.TempDir(os.TempDir(), "chimera-test")
+	defer os.RemoveAll(tmpdir)
+	prepareFiles(tmpdir)
+
+	basedir := filepath.Join(tmpdir, "missing", "app")
+	configs := append(newConfigLogfiles(tmpdir), &ConfigLogfile{
+		Basedir:          basedir,
+		TargetFileRegexp: &Regexp{Regexp: regexp.MustCompile(`^.+/app/.*(\d{8})\.log$`)},
+		FileTimeFormat:   "20060102",
+	})
+	c, ctx := NewCircumstances()
+	w, err := NewWatcher(configs)
+	if !assert.NoError(t, err, "Watcher should be created.") {
+		return
+	}
+	c.RunProcess(ctx, w, false)
+	c.StartProcess.Wait()
+	defer c.Shutdown()
+
+	// other logs are tailed while waiting
+	if !assert.Equal(t, tmpdir, w.waitingBasedir[configs[2]]) {
+		return
+	}
+	if !assert.Len(t, w.watchingFile, 7) {
+		return
+	}
+
+	for i := 0; i < 2; i++ {
+		createFile(tmpdir, "missing/app/foo_20180101.log")
+		time.Sleep(500 * time.Millisecond)
+		if !assert.Empty(t, w.waitingBasedir, "Basedir should be watched") {
+			return
+		}
+		if !assert.Contains(t, w.watchingDir, basedir) {
+			return
+		}
+		if !assert.Len(t, w.watchingFile, 8) {
+			return
+		}
+
+		// deleted, and recreated at the next loop
+		os.RemoveAll(filepath.Join(tmpdir, "missing"))
+		time.Sleep(500 * time.Millisecond)
+		if !assert.Equal(t, tmpdir, w.waitingBasedir[configs[2]], "Basedir should be waited again") {
+			return
+		}
+		if !assert.Len(t, w.watchingFile, 7) {
+			return
+		}
+	}
+}
+
+func TestWatcherWaitBasedirUnderWatchedDir(t *testing.T) {
+	if pdebug.Enabled {
+		g := pdebug.Marker("TestWatcherWaitBasedirUnderWatchedDir")
+		defer g.End()
+	}
+
+	tmpdir, _ := ioutil.TempDir(os.TempDir(), "chimera-test")
+	defer os.RemoveAll(tmpdir)
+	prepareFiles(tmpdir)
+
+	// the nearest ancestor is watched for the recursive config
+	basedir := filepath.Join(tmpdir, "recursive", "test2", "missing", "app")
+	configs := append(newConfigLogfiles(tmpdir), &ConfigLogfile{
+		Basedir:          basedir,
+		TargetFileRegexp: &Regexp{Regexp: regexp.MustCompile(`^.+/app/app\.log$`)},
+	})
+	c, ctx := NewCircumstances()
+	w, err := NewWatcher(configs)
+	if !assert.NoError(t, err, "Watcher should be created.") {
+		return
+	}
+	c.RunProcess(ctx, w, false)
+	c.StartProcess.Wait()
+	defer c.Shutdown()
+
+	if !assert.Equal(t, filepath.Join(tmpdir, "recursive", "test2"), w.waitingBasedir[configs[2]]) {
+		return
+	}
+	if !assert.Len(t, w.watchingFile, 7) {
+		return
+	}
+
+	createFile(tmpdir, "recursive/test2/missing/app/app.log")
+	time.Sleep(500 * time.Millisecond)
+	if !assert.Empty(t, w.waitingBasedir, "Basedir should be watched") {
+		return
+	}
+	if !assert.Contains(t, w.watchingFile, filepath.Join(basedir, "app.log")) {
+		return
+	}
+	assert.Len(t, w.watchingFile, 8)
+}
+
+func TestWatcherInvalidFormat(t *testing.T) {
+	if pdebug.Enabled {
+		g := pdebug.Marker("TestWatcherInvalidFormat")
+		defer g.End()
+	}
+
+	tmpdir, _ := ioutil.TempDir(os.TempDir(), "chimera-test")
+	defer os.RemoveAll(tmpdir)
+	createFile(tmpdir, "foo_20180101.log")
+
+	config := &ConfigLogfile{
+		Basedir:          tmpdir,
+		TargetFileRegexp: &Regexp{Regexp: regexp.MustCompile(`^.+/.*(\d{8})\.log$`)},
+		FileTimeFormat:   "20060102",
+		FieldName:        "message",
+		ConfigParser:     ConfigParser{Format: "no_such_format"},
+	}
+	c, ctx := NewCircumstances()
+	w, err := NewWatcher([]*ConfigLogfile{config})
+	if !assert.NoError(t, err, "Watcher should be created.") {
+		return
+	}
+	c.RunProcess(ctx, w, false)
+	c.StartProcess.Wait()
+	go func() {
+		for range c.MonitorCh {
+		}
+	}()
+	if !assert.Empty(t, w.watchingFile, "file failed to tail should not be watched") {
+		c.Shutdown()
+		return
+	}
+
+	// events of the file and new files do not block the watcher
+	ioutil.WriteFile(filepath.Join(tmpdir, "foo_20180101.log"), []byte("foo\n"), os.ModePerm)
+	createFile(tmpdir, "foo_20180102.log")
+	time.Sleep(500 * time.Millisecond)
+	if !assert.Empty(t, w.watchingFile, "file failed to tail should not be watched") {
+		c.Shutdown()
+		return
+	}
+
+	done := make(chan struct{})
+	go func() {
+		c.Shutdown()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Error("watcher should be shut down")
+	}
+}
+
+func TestWatcherFollowedFileRemoved(t *testing.T) {
+	if pdebug.Enabled {
+		g := pdebug.Marker("TestWatcherFollowedFileRemoved")
+		defer g.End()
+	}
+
+	tmpdir, _ := ioutil.TempDir(os.TempDir(), "chimera-test")
+	defer os.RemoveAll(tmpdir)
+	createFile(tmpdir, "app.log")
+	filename := filepath.Join(tmpdir, "app.log")
+
+	config := &ConfigLogfile{
+		Basedir:          tmpdir,
+		TargetFileRegexp: &Regexp{Regexp: regexp.MustCompile(`^.+/app\.log$`)},
+		FieldName:        "message",
+		RotateWait:       Duration{Duration: 300 * time.Millisecond},
+	}
+	c, ctx := NewCircumstances()
+	w, err := NewWatcher([]*ConfigLogfile{config})
+	if !assert.NoError(t, err, "Watcher should be created.") {
+		return
+	}
+	c.RunProcess(ctx, w, false)
+	c.StartProcess.Wait()
+	defer c.Shutdown()
+	if !assert.Len(t, w.watchingFile, 1) {
+		return
+	}
+
+	// rotated, and never created again
+	os.Rename(filename, filename+".1")
+	os.Remove(filename + ".1")
+	deadline := time.Now().Add(10 * time.Second)
+	for len(w.watchingFile) > 0 && time.Now().Before(deadline) {
+		time.Sleep(100 * time.Millisecond)
+	}
+	if !assert.Empty(t, w.watchingFile, "removed file should be unwatched after RotateWait") {
+		return
+	}
+
+	// tailed again when created
+	createFile(tmpdir, "app.log")
+	time.Sleep(500 * time.Millisecond)
+	assert.Len(t, w.watchingFile, 1, "created file should be tailed")
+}
+
+func TestWatcherPollFollowedFileRemoved(t *testing.T) {
+	if pdebug.Enabled {
+		g := pdebug.Marker("TestWatcherPollFollowedFileRemoved")
+		defer g.End()
+	}
+
+	tmpdir, _ := ioutil.TempDir(os.TempDir(), "chimera-test")
+	defer os.RemoveAll(tmpdir)
+	filename := filepath.Join(tmpdir, "app.log")
+
+	config := &ConfigLogfile{
+		Basedir:          tmpdir,
+		TargetFileRegexp: &Regexp{Regexp: regexp.MustCompile(`^.+/app\.log$`)},
+		FieldName:        "message",
+		RotateWait:       Duration{Duration: 300 * time.Millisecond},
+	}
+	c, ctx := NewCircumstances()
+	defer c.Shutdown()
+	w, err := NewWatcher([]*ConfigLogfile{config})
+	if !assert.NoError(t, err, "Watcher should be created.") {
+		return
+	}
+	// the tail of the removed file is still retrying
+	canceled := false
+	w.watchingDir = map[string]*TargetDir{
+		tmpdir: {Name: tmpdir, ConfigLogs: []*ConfigLogfile{config}},
+	}
+	w.watchingFile = map[string]*TargetFile{
+		filename: {Name: filename, ConfigLogfile: config, Cancel: func() { canceled = true }},
+	}
+	w.reverseMap[filename] = filename
+
+	result := w.poll(ctx, c, config)
+	if !assert.Contains(t, w.watchingFile, filename, "followed file should be kept within RotateWait") {
+		return
+	}
+	if !assert.Equal(t, int64(0), result.staleFiles) {
+		return
+	}
+
+	time.Sleep(400 * time.Millisecond)
+	result = w.poll(ctx, c, config)
+	if !assert.NotContains(t, w.watchingFile, filename, "followed file should be unwatched after RotateWait") {
+		return
+	}
+	assert.Equal(t, int64(1), result.staleFiles)
+	assert.True(t, canceled, "tail should be canceled")
+}
+
+func TestTargetFileDateGroup(t *testing.T) {
+	for _, tc := range []struct {
+		re             string
+		fileTimeFormat string
+		expected       int
+	}{
+		{`^.+/foo_(\d{8})\.log$`, "20060102", 1},
+		{`^.+/(?P<app>[^/]+)_(?P<date>\d{8})\.log$`, "20060102", 2},
+		// the only named group is the date group, as before named groups were supported
+		{`^.+/foo_(?P<d>\d{8})\.log$`, "20060102", 1},
+		{`^.+/(?P<kind>access|error)\.log$`, "", -1},
+		{`^.+/(?P<app>[^/]+)/(?P<kind>access|error)\.log$`, "20060102", -1},
+		// the first unnamed group following named groups
+		{`^.+/(?P<app>[^/]+)/(\d{8})\.log$`, "20060102", 2},
+		{`^.+/(?P<app>[^/]+)/(access|error)\.log$`, "", -1},
+		{`^.+/app\.log$`, "", -1},
+	} {
+		config := &ConfigLogfile{
+			TargetFileRegexp: &Regexp{Regexp: regexp.MustCompile(tc.re)},
+			FileTimeFormat:   tc.fileTimeFormat,
+		}
+		if !assert.Equal(t, tc.expected, targetFileDateGroup(config), tc.re) {
+			return
+		}
+	}
+
+	config := &ConfigLogfile{
+		Tag:              "app",
+		TargetFileRegexp: &Regexp{Regexp: regexp.MustCompile(`^/var/log/app/foo_(?P<d>\d{8})\.log$`)},
+		FileTimeFormat:   "20060102",
+	}
+	foundFile := make(map[string]*TargetFile)
+	for _, path := range []string{"/var/log/app/foo_20180101.log", "/var/log/app/foo_20180102.log"} {
+		if !assert.NoError(t, findFile(path, config, foundFile)) {
+			return
+		}
+	}
+	if !assert.Len(t, foundFile, 1, "only the newest file should be found") {
+		return
+	}
+	for _, target := range foundFile {
+		if !assert.Equal(t, "/var/log/app/foo_20180102.log", target.Name) {
+			return
+		}
+		assert.Nil(t, target.Fields, "the date group should not be a field")
+	}
+
+	// a named group and the unnamed date group
+	config = &ConfigLogfile{
+		Tag:              "app.${app}",
+		TargetFileRegexp: &Regexp{Regexp: regexp.MustCompile(`^/var/log/app/(?P<app>[^/]+)/(\d{8})\.log$`)},
+		FileTimeFormat:   "20060102",
+	}
+	if !assert.False(t, followsRotation(config), "files should not be followed across rotation") {
+		return
+	}
+	foundFile = make(map[string]*TargetFile)
+	for _, path := range []string{"/var/log/app/api/20180101.log", "/var/log/app/api/20180102.log", "/var/log/app/web/20180101.log"} {
+		if !assert.NoError(t, findFile(path, config, foundFile)) {
+			return
+		}
+	}
+	if !assert.Len(t, foundFile, 2, "the newest file of each app should be found") {
+		return
+	}
+	for _, expected := range []struct {
+		name string
+		tag  string
+	}{
+		{"/var/log/app/api/20180102.log", "app.api"},
+		{"/var/log/app/web/20180101.log", "app.web"},
+	} {
+		var target *TargetFile
+		for _, found := range foundFile {
+			if found.Name == expected.name {
+				target = found
+			}
+		}
+		if !assert.NotNil(t, target, expected.name) {
+			return
+		}
+		if !assert.Equal(t, expected.tag, target.Tag) {
+			return
+		}
+	}
+}